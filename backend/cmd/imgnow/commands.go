@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gabrielsy/imgnow/pkg/client"
+	"time"
+)
+
+// settingsFlags registers the flags matching client.FileSettings on flags.
+// The returned function builds the settings from the flags that were set,
+// leaving the others unchanged on the server.
+func settingsFlags(flags *flag.FlagSet) func() (client.FileSettings, error) {
+	expiresIn := flags.String("expires-in", "", "expire at this time (RFC 3339)")
+	expiresAfter := flags.String("expires-after", "", "expire after this long, e.g. 1h, 1d or 7d")
+	expiresAfterFirstView := flags.String("expires-after-first-view", "", "expire this long after the first view, e.g. 24h")
+	burn := flags.Bool("burn", false, "delete after a single view")
+	uniqueViews := flags.Bool("unique-views", false, "view limits count unique viewers")
+	maxViews := flags.Int("max-views", 0, "delete after this many views")
+	maxDownloads := flags.Int("max-downloads", 0, "delete after this many downloads")
+	password := flags.String("password", "", "password protect the file")
+
+	return func() (client.FileSettings, error) {
+		settings := client.FileSettings{}
+		var err error
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "expires-in":
+				expires, parseErr := time.Parse(time.RFC3339, *expiresIn)
+				if parseErr != nil {
+					err = fmt.Errorf("expires-in must be an RFC 3339 time: %w", parseErr)
+				}
+				settings.ExpiresIn = &expires
+			case "expires-after":
+				settings.ExpiresAfter = expiresAfter
+			case "expires-after-first-view":
+				settings.ExpiresAfterFirstView = expiresAfterFirstView
+			case "burn":
+				settings.BurnAfterReading = *burn
+			case "unique-views":
+				settings.CountUniqueViews = uniqueViews
+			case "max-views":
+				settings.DeletesAfterVizualizations = true
+				settings.VizualizationsForDeletion = maxViews
+			case "max-downloads":
+				settings.DeletesAfterDownload = true
+				settings.DownloadsForDeletion = maxDownloads
+			case "password":
+				settings.Password = password
+			}
+		})
+		return settings, err
+	}
+}
+
+func runInfo(api *client.Client, args []string) error {
+	flags := flag.NewFlagSet("info", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: imgnow info <customUrl>")
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("info takes a single custom URL")
+	}
+
+	file, err := api.Info(context.Background(), flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printJSON(file)
+}
+
+// runSettings updates the settings of a file and prints the file as it is
+// afterwards.
+func runSettings(api *client.Client, args []string) error {
+	flags := flag.NewFlagSet("settings", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: imgnow settings [flags] <customUrl>")
+		flags.PrintDefaults()
+	}
+	settings := settingsFlags(flags)
+	managementToken := flags.String("management-token", "", "management token returned on upload, for files not owned by the API key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("settings takes a single custom URL")
+	}
+
+	request, err := settings()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := api.UpdateSettings(ctx, flags.Arg(0), *managementToken, request); err != nil {
+		return err
+	}
+
+	file, err := api.Info(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printJSON(file)
+}
+
+func runDelete(api *client.Client, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: imgnow delete [flags] <customUrl>")
+		flags.PrintDefaults()
+	}
+	managementToken := flags.String("management-token", "", "management token returned on upload, for files not owned by the API key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("delete takes a single custom URL")
+	}
+
+	restorableUntil, err := api.Delete(context.Background(), flags.Arg(0), *managementToken)
+	if err != nil {
+		return err
+	}
+	return printJSON(map[string]any{
+		"customUrl":       flags.Arg(0),
+		"restorableUntil": restorableUntil,
+	})
+}
+
+func runList(api *client.Client, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: imgnow list [flags]")
+		flags.PrintDefaults()
+	}
+	fileType := flags.String("type", "", "only files of this type: image, video or audio")
+	status := flags.String("status", "", "only files with this status")
+	trashed := flags.Bool("trashed", false, "list the trash instead")
+	from := flags.String("from", "", "only files created on or after this date (YYYY-MM-DD or RFC 3339)")
+	to := flags.String("to", "", "only files created before this date (YYYY-MM-DD or RFC 3339)")
+	page := flags.Int("page", 1, "page to list")
+	pageSize := flags.Int("page-size", 20, "files per page, at most 100")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !api.HasAPIKey() {
+		return errors.New("list needs an API key, set -token or IMGNOW_TOKEN")
+	}
+
+	options := client.ListOptions{
+		Type:     *fileType,
+		Status:   client.FileStatus(*status),
+		Trashed:  *trashed,
+		Page:     *page,
+		PageSize: *pageSize,
+	}
+	var err error
+	if options.CreatedAfter, err = parseDate(*from); err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	if options.CreatedBefore, err = parseDate(*to); err != nil {
+		return fmt.Errorf("to: %w", err)
+	}
+
+	list, err := api.List(context.Background(), options)
+	if err != nil {
+		return err
+	}
+	return printJSON(list)
+}
+
+// parseDate parses an RFC 3339 timestamp or a plain YYYY-MM-DD date,
+// returning nil for an empty value.
+func parseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return &parsed, nil
+	}
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
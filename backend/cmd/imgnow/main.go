@@ -0,0 +1,88 @@
+// Command imgnow uploads and manages files on an imgnow server from the
+// command line.
+//
+//	imgnow [-server URL] [-token KEY] <command> [flags] [args]
+//
+// The server and token default to the IMGNOW_SERVER and IMGNOW_TOKEN
+// environment variables. Tokens are API keys created in the web app.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gabrielsy/imgnow/pkg/client"
+	"os"
+)
+
+const defaultServer = "http://localhost:8080"
+
+const usage = `Usage: imgnow [-server URL] [-token KEY] <command> [flags] [args]
+
+Commands:
+  upload [flags] <file|->   upload a file, or stdin with -
+  info <customUrl>          show a file
+  settings [flags] <customUrl>
+                            change the expiry, password or limits of a file
+  delete <customUrl>        move a file to the trash
+  list [flags]              list your files
+
+Run imgnow <command> -h for the flags of a command.
+`
+
+type command func(api *client.Client, args []string) error
+
+var commands = map[string]command{
+	"upload":   runUpload,
+	"info":     runInfo,
+	"settings": runSettings,
+	"delete":   runDelete,
+	"list":     runList,
+}
+
+func main() {
+	flags := flag.NewFlagSet("imgnow", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	server := flags.String("server", envOr("IMGNOW_SERVER", defaultServer), "imgnow server URL")
+	token := flags.String("token", os.Getenv("IMGNOW_TOKEN"), "API key")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	run, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "imgnow: unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	api := client.New(*server, client.WithAPIKey(*token))
+	if err := run(api, flags.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintf(os.Stderr, "imgnow: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// printJSON writes a response to stdout, indented for reading and piping
+// into jq.
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
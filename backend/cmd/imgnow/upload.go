@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"gabrielsy/imgnow/pkg/client"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+func runUpload(api *client.Client, args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: imgnow upload [flags] <file|->")
+		flags.PrintDefaults()
+	}
+	settings := settingsFlags(flags)
+	customUrl := flags.String("custom-url", "", "custom URL for the file")
+	name := flags.String("name", "", "file name, required to name stdin uploads")
+	contentType := flags.String("type", "", "content type, detected from the name or content when unset")
+	wait := flags.Bool("wait", true, "wait until the file is processed")
+	timeout := flags.Duration("timeout", 5*time.Minute, "how long to wait for processing")
+	raw := flags.Bool("raw", false, "print the direct file URL instead of the share page")
+	copyUrl := flags.Bool("copy", false, "copy the URL to the clipboard")
+	asJSON := flags.Bool("json", false, "print the full upload response as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("upload takes a single file, or - for stdin")
+	}
+
+	request, err := settings()
+	if err != nil {
+		return err
+	}
+
+	src, filename, err := openUpload(flags.Arg(0), *name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	ctx := context.Background()
+	upload, err := api.Upload(ctx, src, client.UploadOptions{
+		Name:        filename,
+		ContentType: *contentType,
+		CustomUrl:   *customUrl,
+		Settings:    request,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *wait && upload.Status == client.StatusPending {
+		waitCtx, cancel := context.WithTimeout(ctx, *timeout)
+		defer cancel()
+		if err := api.WaitUntilActive(waitCtx, upload.CustomUrl, 0); err != nil {
+			return fmt.Errorf("waiting for %s: %w", upload.CustomUrl, err)
+		}
+		upload.Status = client.StatusActive
+	}
+
+	link := upload.PageURL
+	if *raw || link == "" {
+		link = upload.URL
+	}
+	if *copyUrl {
+		if err := copyToClipboard(link); err != nil {
+			fmt.Fprintf(os.Stderr, "imgnow: failed to copy the URL: %v\n", err)
+		}
+	}
+
+	if *asJSON {
+		return printJSON(upload)
+	}
+	fmt.Println(link)
+	return nil
+}
+
+// openUpload opens the file to upload, with - meaning stdin. Uploads are
+// named after the file unless name is set.
+func openUpload(path string, name string) (io.ReadCloser, string, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), name, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	return file, name, nil
+}
+
+// copyToClipboard copies text with the clipboard tool of the platform.
+func copyToClipboard(text string) error {
+	for _, tool := range clipboardTools() {
+		path, err := exec.LookPath(tool[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, tool[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return errors.New("no clipboard tool found")
+}
+
+func clipboardTools() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	default:
+		return [][]string{
+			{"wl-copy"},
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package apierror writes the error body shared by every API endpoint:
+//
+//	{"error": {"code": "not_found", "message": "File not found", "details": {...}, "requestId": "..."}}
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID of a request, set on every response by
+// middleware.RequestID and echoed in error bodies.
+const RequestIDHeader = "X-Request-ID"
+
+// Code identifies the kind of error independently of its message.
+type Code string
+
+const (
+	BadRequest       Code = "bad_request"
+	Unauthorized     Code = "unauthorized"
+	Forbidden        Code = "forbidden"
+	NotFound         Code = "not_found"
+	MethodNotAllowed Code = "method_not_allowed"
+	Conflict         Code = "conflict"
+	Gone             Code = "gone"
+	TooLarge         Code = "payload_too_large"
+	NotReady         Code = "not_ready"
+	RateLimited      Code = "rate_limited"
+	Internal         Code = "internal_error"
+	NotImplemented   Code = "not_implemented"
+	Unavailable      Code = "unavailable"
+)
+
+// Error is the body of an error response.
+type Error struct {
+	Code      Code   `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Abort writes an error response with the code of status and stops the
+// handler chain.
+func Abort(c *gin.Context, status int, message string) {
+	AbortWithDetails(c, status, message, nil)
+}
+
+// AbortWithDetails is Abort with machine-readable details, like the field
+// that failed validation.
+func AbortWithDetails(c *gin.Context, status int, message string, details any) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"error": Error{
+			Code:      CodeFor(status),
+			Message:   message,
+			Details:   details,
+			RequestID: c.Writer.Header().Get(RequestIDHeader),
+		},
+	})
+}
+
+// CodeFor returns the code of errors with the given status.
+func CodeFor(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return BadRequest
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusMethodNotAllowed:
+		return MethodNotAllowed
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusGone:
+		return Gone
+	case http.StatusRequestEntityTooLarge:
+		return TooLarge
+	case http.StatusTooEarly:
+		return NotReady
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusNotImplemented:
+		return NotImplemented
+	case http.StatusServiceUnavailable:
+		return Unavailable
+	}
+	if status >= 500 {
+		return Internal
+	}
+	return BadRequest
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	_ "embed"
+	"gabrielsy/imgnow/internal/app"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec describes the API served under util.APIPrefix. It is kept by
+// hand next to the routes, update it with them.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+type DocsController struct {
+	app *app.Application
+}
+
+func NewDocsController(app *app.Application) *DocsController {
+	return &DocsController{
+		app: app,
+	}
+}
+
+// OpenAPI serves the OpenAPI 3 document of the API.
+func (dc *DocsController) OpenAPI(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", openAPISpec)
+}
@@ -1,14 +1,24 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"gabrielsy/imgnow/internal/apierror"
 	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/middleware"
 	fileRepo "gabrielsy/imgnow/internal/repository/file"
 	service "gabrielsy/imgnow/internal/service"
 	"gabrielsy/imgnow/internal/types"
 	"gabrielsy/imgnow/internal/util"
+	"io"
+	"math"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,131 +37,310 @@ func NewFileController(app *app.Application) *FileController {
 
 func (fc *FileController) UploadFile(c *gin.Context) {
 	fileService := service.NewFileService(fc.app)
-	file, err := c.FormFile("file")
+
+	// Reject oversized uploads before reading any of the body
+	maxUploadSize := fileService.MaxUploadSize()
+	if c.Request.ContentLength > maxUploadSize {
+		apierror.Abort(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds the maximum upload size of %d bytes", maxUploadSize))
+		return
+	}
+
+	// Bodies without a Content-Length are cut off once they exceed what is
+	// left of the uploader's storage quota
+	quotaLimited := false
+	if remaining := middleware.RemainingQuotaBytes(c); remaining >= 0 && remaining < maxUploadSize {
+		maxUploadSize = remaining
+		quotaLimited = true
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
+
+	part, filename, contentType, settingsField, err := uploadedFile(c.Request)
 	if err != nil {
 		util.LogError(err, "Failed to get file", fc.app)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err})
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
-	contentType := file.Header.Get("Content-Type")
-	if !strings.Contains(contentType, "image/") && !strings.Contains(contentType, "video/") {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only image files are allowed"})
+	defer part.Close()
+
+	// Only the bare media type is kept, so parameters can never smuggle in
+	// another type
+	contentType, ok := util.UploadMediaType(contentType)
+	if !ok {
+		apierror.Abort(c, http.StatusBadRequest, "Only image, video and audio files are allowed")
+		return
+	}
+
+	// Expiry options are query parameters so they are known before the body
+	settings := types.FileSettings{}
+	if expiresAfter := c.Query("expiresAfter"); expiresAfter != "" {
+		settings.ExpiresAfter = &expiresAfter
+	}
+	if expiresAfterFirstView := c.Query("expiresAfterFirstView"); expiresAfterFirstView != "" {
+		settings.ExpiresAfterFirstView = &expiresAfterFirstView
+	}
+	settings.BurnAfterReading = c.Query("burnAfterReading") == "true"
+	if c.Query("countUniqueViews") == "true" {
+		countUniqueViews := true
+		settings.CountUniqueViews = &countUniqueViews
+	}
+	// Passwords and limits come in the "settings" form field ahead of the
+	// file, so the file never exists without them
+	if settingsField != nil {
+		if err := json.Unmarshal(settingsField, &settings); err != nil {
+			apierror.Abort(c, http.StatusBadRequest, "Invalid settings: "+err.Error())
+			return
+		}
+	}
+	createdAt := time.Now()
+	if err := fileService.NormalizeSettings(&settings, createdAt, true); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	var password *string
+	if settings.Password != nil {
+		if password, err = util.HashPassword(settings.Password); err != nil {
+			util.LogError(err, "Failed to hash password", fc.app)
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to upload file")
+			return
+		}
+	}
+
 	urlName := c.Query("customUrl")
 	customUrl, err := fileService.GenerateCustomUrl(urlName)
 	if err != nil {
 		util.LogError(err, "Failed to generate custom URL", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		apierror.Abort(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	managementToken, managementTokenHash, err := service.NewManagementToken()
+	if err != nil {
+		util.LogError(err, "Failed to generate management token", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to upload file")
 		return
 	}
 
 	fileRecord := &types.File{
 		CustomUrl:    customUrl,
-		OriginalName: strings.TrimSuffix(file.Filename, filepath.Ext(file.Filename)),
-		Size:         int(file.Size),
-		Type:         file.Header.Get("Content-Type"),
-		CreatedAt:    time.Now(),
+		OriginalName: strings.TrimSuffix(filename, filepath.Ext(filename)),
+		Type:         contentType,
+		CreatedAt:    createdAt,
 		Status:       types.Pending,
+		ExpiresIn:    settings.ExpiresIn,
+
+		ExpiresAfterViewSeconds:    service.ExpiresAfterViewSeconds(settings),
+		DeletesAfterDownload:       settings.DeletesAfterDownload,
+		DownloadsForDeletion:       settings.DownloadsForDeletion,
+		DeletesAfterVizualizations: settings.DeletesAfterVizualizations,
+		VizualizationsForDeletion:  settings.VizualizationsForDeletion,
+		Password:                   password,
+		ManagementTokenHash:        &managementTokenHash,
+		CountUniqueViews:           settings.CountUniqueViews != nil && *settings.CountUniqueViews,
+	}
+	if user := middleware.CurrentUser(c); user != nil {
+		fileRecord.OwnerId = &user.Id
 	}
+	uploader := middleware.UploaderIdentity(c)
+	fileRecord.Uploader = &uploader
 
+	// Files stored as-is go straight to R2 while the request body is read
+	if !service.RequiresProcessing(contentType) {
+		size, err := fileService.StreamUpload(part, contentType, customUrl)
+		if err != nil {
+			uploadError(c, err, quotaLimited)
+			return
+		}
+
+		fileRecord.Size = int(size)
+		fileRecord.Status = types.Active
+		err = fileRepo.CreateFile(fc.app, fileRecord)
+		if err != nil {
+			util.LogError(err, "Failed to create file record", fc.app)
+			fileService.DeleteFile(customUrl)
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to create file record")
+			return
+		}
+		fileService.UpdateFilePath(customUrl)
+		service.NewWebhookService(fc.app).Emit(fileRecord, types.WebhookUploadCompleted, nil)
+
+		response := gin.H{
+			"message":         "File uploaded",
+			"status":          types.Active,
+			"customUrl":       customUrl,
+			"statusUrl":       util.APIPrefix + "/file/" + url.PathEscape(customUrl) + "/status",
+			"expiresAt":       fileRecord.ExpiresIn,
+			"managementToken": managementToken,
+		}
+		for key, value := range fc.uploadLinks(c, fileRecord, managementToken) {
+			response[key] = value
+		}
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	upload, err := fileService.SpoolUpload(part, filename, contentType)
+	if err != nil {
+		util.LogError(err, "Failed to spool upload", fc.app)
+		uploadError(c, err, quotaLimited)
+		return
+	}
+
+	fileRecord.Size = int(upload.Size)
 	err = fileRepo.CreateFile(fc.app, fileRecord)
 	if err != nil {
 		util.LogError(err, "Failed to create initial file record", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		upload.Remove()
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to create file record")
 		return
 	}
 
 	// Upload async, update file status and path after upload
+	webhookService := service.NewWebhookService(fc.app)
 	go func() {
-		err = fileService.UploadFile(file, customUrl)
+		defer upload.Remove()
+		err := fileService.UploadFile(upload, customUrl)
 		if err != nil {
 			util.LogError(err, "Failed to upload file to R2", fc.app)
-			fileRecord.Status = types.Error
 			fileRepo.UpdateFileStatus(fc.app, customUrl, types.Error)
+			webhookService.EmitFor(customUrl, types.WebhookUploadFailed, map[string]any{"error": "File processing failed"})
 			return
 		}
-		fileRecord.Status = types.Active
 		fileRepo.UpdateFileStatus(fc.app, customUrl, types.Active)
 		fileService.UpdateFilePath(customUrl)
+		webhookService.EmitFor(customUrl, types.WebhookUploadCompleted, nil)
 	}()
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":   "File upload started",
-		"status":    types.Pending,
-		"customUrl": customUrl,
-		"statusUrl": fmt.Sprintf("/api/file/status?customUrl=%s", customUrl),
-	})
+	response := gin.H{
+		"message":         "File upload started",
+		"status":          types.Pending,
+		"customUrl":       customUrl,
+		"statusUrl":       util.APIPrefix + "/file/" + url.PathEscape(customUrl) + "/status",
+		"expiresAt":       fileRecord.ExpiresIn,
+		"managementToken": managementToken,
+	}
+	for key, value := range fc.uploadLinks(c, fileRecord, managementToken) {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func (fc *FileController) GetFileByCustomUrl(c *gin.Context) {
-	customUrl := c.Param("customUrl")
-	if customUrl == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Custom URL parameter is required"})
-		return
+// uploadLinks are the absolute URLs returned for a new upload, in the shape
+// screenshot tools like ShareX read from the response: the raw file, a
+// thumbnail for images, which never counts a view, and a page that deletes
+// the file.
+func (fc *FileController) uploadLinks(c *gin.Context, file *types.File, managementToken string) gin.H {
+	publicUrl := util.PublicURL(c.Request, fc.app)
+	escapedUrl := url.PathEscape(file.CustomUrl)
+
+	thumbnailUrl := ""
+	if service.HasThumbnail(file.Type) {
+		thumbnailUrl = publicUrl + "/i/" + escapedUrl + "/thumbnail"
 	}
 
-	file, err := fileRepo.FindFileByCustomUrl(fc.app, customUrl)
-	if err != nil {
-		util.LogError(err, "Failed to find file", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
-		return
+	return gin.H{
+		"url":          publicUrl + "/i/" + escapedUrl + util.ExtensionForType(file.Type),
+		"pageUrl":      publicUrl + "/" + escapedUrl,
+		"thumbnailUrl": thumbnailUrl,
+		"deletionUrl":  publicUrl + util.APIPrefix + "/file/" + escapedUrl + "/delete?token=" + url.QueryEscape(managementToken),
 	}
+}
 
-	if file == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
-		return
+// maxSettingsFieldSize caps the JSON settings sent along with an upload.
+const maxSettingsFieldSize = 64 << 10
+
+// uploadedFile returns the uploaded file with its name and content type, and
+// the JSON of the multipart "settings" field when it precedes the file.
+// The file is read from the multipart "file" part or, for clients posting
+// the file as the raw body like ShareX's binary mode or curl --data-binary,
+// from the body itself, named by the filename query parameter.
+func uploadedFile(r *http.Request) (io.ReadCloser, string, string, []byte, error) {
+	contentType := r.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "multipart/form-data" {
+		part, settings, err := nextFilePart(r)
+		if err != nil {
+			return nil, "", "", nil, err
+		}
+		return part, part.FileName(), part.Header.Get("Content-Type"), settings, nil
 	}
 
-	if file.Status == types.Pending {
-		c.JSON(http.StatusTooEarly, gin.H{"error": "File is still being processed"})
-		return
+	filename := r.URL.Query().Get("filename")
+	if filename == "" {
+		filename = "upload" + util.ExtensionForType(contentType)
 	}
+	return r.Body, filename, contentType, nil, nil
+}
 
-	// Check if file has expired
-	if file.ExpiresIn != nil && file.ExpiresIn.Before(time.Now()) {
-		fileService := service.NewFileService(fc.app)
-		err = fileService.DeleteFile(customUrl)
+// nextFilePart reads the multipart body up to the "file" part without
+// buffering it, so the caller can stream the part itself. A "settings"
+// field met on the way is returned with it.
+func nextFilePart(r *http.Request) (*multipart.Part, []byte, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var settings []byte
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("missing file field")
+		}
 		if err != nil {
-			util.LogError(err, "Failed to delete expired file", fc.app)
+			return nil, nil, err
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			return part, settings, nil
 		}
-		c.JSON(http.StatusNotFound, gin.H{"error": "File has expired"})
+		if part.FormName() == "settings" {
+			settings, err = io.ReadAll(io.LimitReader(part, maxSettingsFieldSize+1))
+			if err == nil && len(settings) > maxSettingsFieldSize {
+				err = fmt.Errorf("settings field is too large")
+			}
+			if err != nil {
+				part.Close()
+				return nil, nil, err
+			}
+		}
+		part.Close()
+	}
+}
+
+func uploadError(c *gin.Context, err error, quotaLimited bool) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) && quotaLimited {
+		apierror.Abort(c, http.StatusTooManyRequests, "Storage quota exceeded")
+		return
+	}
+	if errors.As(err, &maxBytesErr) {
+		apierror.Abort(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("File exceeds the maximum upload size of %d bytes", maxBytesErr.Limit))
 		return
 	}
+	apierror.Abort(c, http.StatusInternalServerError, "Failed to upload file")
+}
 
-	// Check if file has been deleted
-	if file.DeletedAt != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File has been deleted"})
+func (fc *FileController) GetFileByCustomUrl(c *gin.Context) {
+	customUrl := c.Param("customUrl")
+	if customUrl == "" {
+		apierror.Abort(c, http.StatusBadRequest, "Custom URL parameter is required")
 		return
 	}
 
-	// Check if file requires password
-	hashedPassword, err := fileRepo.GetFilePassword(fc.app, customUrl)
+	file, err := fileRepo.FindFileByCustomUrl(fc.app, customUrl)
 	if err != nil {
-		util.LogError(err, "Failed to get file password", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify password"})
+		util.LogError(err, "Failed to find file", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
 		return
 	}
 
-	// If file has password but no password was provided in request
-	if hashedPassword != nil {
-		var requestBody struct {
-			Password string `json:"password"`
-		}
-
-		if err := c.ShouldBindJSON(&requestBody); err != nil {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":            "Password required",
-				"requiresPassword": true,
-			})
-			return
-		}
+	if !fc.checkFileAvailable(c, file) {
+		return
+	}
 
-		if !util.CheckPasswordHash(requestBody.Password, *hashedPassword) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
-			return
-		}
+	access, ok := fc.authorizeFileAccess(c, file)
+	if !ok {
+		return
 	}
 	// To be used with permanent urls
 	/*
@@ -164,43 +353,251 @@ func (fc *FileController) GetFileByCustomUrl(c *gin.Context) {
 					}
 	*/
 
-	r2 := service.NewR2Service(fc.app)
-	fileUrl, err := r2.GetFromR2(customUrl)
-	if err != nil {
-		util.LogError(err, "Failed to get file from R2", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+	fileUrl, ok := fc.viewFile(c, file, nil)
+	if !ok {
 		return
 	}
+	response := gin.H{
+		"path": fileUrl,
+	}
+	for key, value := range access {
+		response[key] = value
+	}
+	c.JSON(http.StatusOK, response)
+}
 
+// viewFile returns a URL for the file, writing the error response and
+// returning false when it cannot be viewed. The view is claimed before any
+// URL is issued, so view limits hold under concurrent requests. Crawlers are
+// neither counted nor recorded, and never see view-limited files.
+func (fc *FileController) viewFile(c *gin.Context, file *types.File, shareLinkId *int) (string, bool) {
 	fileService := service.NewFileService(fc.app)
 
-	err = fileService.TrackFileSettings(customUrl)
+	var fileUrl string
+	var err error
+	crawler := util.IsBot(c.Request.UserAgent())
+	if crawler {
+		fileUrl, err = fileService.PreviewFile(file)
+	} else if shareLinkId != nil {
+		fileUrl, err = fileService.ViewSharedFile(file.CustomUrl, *shareLinkId, service.ViewerKey(fc.app, viewer(c)))
+	} else {
+		fileUrl, err = fileService.ViewFile(file.CustomUrl, service.ViewerKey(fc.app, viewer(c)))
+	}
+
+	if errors.Is(err, service.ErrShareLinkInactive) {
+		apierror.Abort(c, http.StatusGone, err.Error())
+		return "", false
+	}
+	if errors.Is(err, service.ErrViewLimitReached) {
+		apierror.Abort(c, http.StatusGone, "File is no longer available")
+		return "", false
+	}
+	if errors.Is(err, service.ErrHiddenFromCrawlers) {
+		apierror.Abort(c, http.StatusForbidden, err.Error())
+		return "", false
+	}
 	if err != nil {
-		util.LogError(err, "Failed to track file visualization", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track file visualization"})
+		util.LogError(err, "Failed to get file from R2", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get file")
+		return "", false
+	}
+
+	if !crawler {
+		service.NewAnalyticsService(fc.app).Record(file, types.EventView, viewer(c), shareLinkId)
+	}
+	return fileUrl, true
+}
+
+// checkFileAvailable writes the error response and returns false when the
+// file is missing, still processing, deleted or expired. Expired files are
+// deleted on the spot.
+func (fc *FileController) checkFileAvailable(c *gin.Context, file *types.File) bool {
+	if file == nil {
+		apierror.Abort(c, http.StatusNotFound, "File not found")
+		return false
+	}
+
+	if file.Status == types.Pending {
+		apierror.Abort(c, http.StatusTooEarly, "File is still being processed")
+		return false
+	}
+
+	// Check if file has been deleted
+	if file.DeletedAt != nil || file.TrashedAt != nil {
+		apierror.Abort(c, http.StatusNotFound, "File has been deleted")
+		return false
+	}
+
+	// Check if file has expired
+	if file.ExpiresIn != nil && file.ExpiresIn.Before(time.Now()) {
+		service.NewFileService(fc.app).ExpireFile(file)
+		apierror.Abort(c, http.StatusNotFound, "File has expired")
+		return false
+	}
+
+	return true
+}
+
+// authorizeFileAccess lets a request through to a password-protected file
+// when it carries a valid access token or the right password. A correct
+// password is exchanged for a new access token, set as a cookie and returned
+// for the handler to include in its response. On failure the response is
+// written and ok is false.
+func (fc *FileController) authorizeFileAccess(c *gin.Context, file *types.File) (access gin.H, ok bool) {
+	if file.Password == nil {
+		return nil, true
+	}
+
+	tokens := service.NewAccessTokenService(fc.app)
+	if tokens.Verify(accessToken(c, file), file) {
+		return nil, true
+	}
+
+	if !fc.verifyPassword(c, file, *file.Password) {
+		return nil, false
+	}
+
+	token, expiresAt, err := tokens.Issue(file)
+	if err != nil {
+		util.LogError(err, "Failed to issue access token", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to issue access token")
+		return nil, false
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(service.AccessCookieName(file.CustomUrl), token, int(tokens.TTL().Seconds()), "/", "", c.Request.TLS != nil, true)
+
+	return gin.H{
+		"accessToken":          token,
+		"accessTokenExpiresAt": expiresAt,
+	}, true
+}
+
+// verifyPassword checks the password in the JSON body against hashedPassword,
+// subject to the brute-force guard of the file. On failure the response is
+// written and false is returned.
+func (fc *FileController) verifyPassword(c *gin.Context, file *types.File, hashedPassword string) bool {
+	var requestBody struct {
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		apierror.AbortWithDetails(c, http.StatusForbidden, "Password required", gin.H{"requiresPassword": true})
+		return false
+	}
+
+	guard := service.NewPasswordGuardService(fc.app)
+	gate, err := guard.Reserve(file, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to verify password")
+		return false
+	}
+	if !gate.Allowed {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(gate.RetryAfter.Seconds()))))
+		if gate.Locked {
+			apierror.Abort(c, http.StatusLocked, "Too many failed password attempts, file is temporarily locked")
+			return false
+		}
+		apierror.Abort(c, http.StatusTooManyRequests, "Too many failed password attempts, try again later")
+		return false
+	}
+
+	if !util.CheckPasswordHash(requestBody.Password, hashedPassword) {
+		apierror.Abort(c, http.StatusUnauthorized, "Invalid password")
+		return false
+	}
+	guard.Succeeded(file, c.ClientIP(), gate)
+
+	return true
+}
+
+// accessToken finds a file access token in the X-Access-Token header, the
+// access_token query parameter (for <img> and <video> sources), a bearer
+// token or the file's access cookie.
+func accessToken(c *gin.Context, file *types.File) string {
+	if token := c.GetHeader("X-Access-Token"); token != "" {
+		return token
+	}
+	if token := c.Query("access_token"); token != "" {
+		return token
+	}
+	// A session token may start like an access token, and is known as a
+	// session once it has authenticated a user
+	if token := middleware.RequestToken(c); strings.HasPrefix(token, service.AccessTokenPrefix) && middleware.CurrentUser(c) == nil {
+		return token
+	}
+	token, _ := c.Cookie(service.AccessCookieName(file.CustomUrl))
+	return token
+}
+
+// GetFileByShareLink serves a file through one of its share links. The link
+// replaces the file's own password; links may carry a password of their own.
+func (fc *FileController) GetFileByShareLink(c *gin.Context) {
+	shareLinkService := service.NewShareLinkService(fc.app)
+	link, file, err := shareLinkService.Resolve(c.Param("token"))
+	if errors.Is(err, service.ErrShareLinkNotFound) {
+		apierror.Abort(c, http.StatusNotFound, "Share link not found")
+		return
+	}
+	if errors.Is(err, service.ErrShareLinkInactive) {
+		apierror.Abort(c, http.StatusGone, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to resolve share link")
+		return
+	}
+
+	if !fc.checkFileAvailable(c, file) {
+		return
+	}
+
+	if link.Password != nil && !fc.verifyPassword(c, file, *link.Password) {
+		return
+	}
+
+	// Crawlers never spend file views, so only the link's view is counted
+	// for them. Other viewers spend both together in viewFile.
+	if util.IsBot(c.Request.UserAgent()) {
+		err = shareLinkService.ConsumeView(link)
+		if errors.Is(err, service.ErrShareLinkInactive) {
+			apierror.Abort(c, http.StatusGone, err.Error())
+			return
+		}
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to track share link view")
+			return
+		}
+	}
+
+	// Views through links still count towards the file's own limits
+	fileUrl, ok := fc.viewFile(c, file, &link.Id)
+	if !ok {
 		return
 	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"path": fileUrl,
+		"path":  fileUrl,
+		"label": link.Label,
+		"type":  file.Type,
 	})
 }
 
 func (fc *FileController) GetFileStatus(c *gin.Context) {
 	customUrl := c.Param("customUrl")
 	if customUrl == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Custom URL parameter is required"})
+		apierror.Abort(c, http.StatusBadRequest, "Custom URL parameter is required")
 		return
 	}
 
 	file, err := fileRepo.FindFileByCustomUrl(fc.app, customUrl)
 	if err != nil {
 		util.LogError(err, "Failed to find file", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
 		return
 	}
 
 	if file == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		apierror.Abort(c, http.StatusNotFound, "File not found")
 		return
 	}
 
@@ -209,43 +606,182 @@ func (fc *FileController) GetFileStatus(c *gin.Context) {
 	})
 }
 
+// UpdateFileSettings changes the password, limits or expiry of a file its
+// caller manages.
 func (fc *FileController) UpdateFileSettings(c *gin.Context) {
-	customUrl := c.Param("customUrl")
-	if customUrl == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Custom URL parameter is required"})
+	file := fc.managedFile(c)
+	if file == nil {
 		return
 	}
 
 	var request types.FileSettings
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
 	fileService := service.NewFileService(fc.app)
-	err := fileService.HandleConfiguration(request, customUrl)
+	err := fileService.HandleConfiguration(request, file.CustomUrl)
+	if errors.Is(err, service.ErrInvalidSettings) {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		util.LogError(err, "Failed to handle file configuration", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to handle file configuration"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to handle file configuration")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "File settings updated successfully"})
 }
 
+// DeleteFile moves a file to the trash, from where it can be restored until
+// the restore window passes.
+func (fc *FileController) DeleteFile(c *gin.Context) {
+	file := fc.managedFile(c)
+	if file == nil {
+		return
+	}
+
+	trashService := service.NewTrashService(fc.app)
+	restorableUntil, err := trashService.Trash(file.CustomUrl)
+	if errors.Is(err, service.ErrAlreadyTrashed) {
+		apierror.Abort(c, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to delete file")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "File moved to trash",
+		"restorableUntil": restorableUntil,
+	})
+}
+
+func (fc *FileController) RestoreFile(c *gin.Context) {
+	file := fc.managedFile(c)
+	if file == nil {
+		return
+	}
+
+	trashService := service.NewTrashService(fc.app)
+	err := trashService.Restore(file.CustomUrl)
+	if errors.Is(err, service.ErrNotRestorable) {
+		apierror.Abort(c, http.StatusGone, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to restore file")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File restored"})
+}
+
+// GetFileStats returns the file's views and downloads over time for its
+// owner. interval is "hour" or "day" and from/to default to the last 48
+// hours or 30 days respectively.
+func (fc *FileController) GetFileStats(c *gin.Context) {
+	file := fc.managedFile(c)
+	if file == nil {
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "day")
+	to := time.Now()
+	from := to.Add(-30 * 24 * time.Hour)
+	if interval == "hour" {
+		from = to.Add(-48 * time.Hour)
+	}
+
+	if parsed, err := util.ParseDate(c.Query("to")); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "to must be a date")
+		return
+	} else if parsed != nil {
+		to = *parsed
+	}
+	if parsed, err := util.ParseDate(c.Query("from")); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "from must be a date")
+		return
+	} else if parsed != nil {
+		from = *parsed
+	}
+
+	analyticsService := service.NewAnalyticsService(fc.app)
+	stats, err := analyticsService.Stats(file, interval, from, to)
+	if errors.Is(err, service.ErrInvalidStatsRange) {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		util.LogError(err, "Failed to get file stats", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get file stats")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// viewer describes the request for the analytics event log.
+func viewer(c *gin.Context) types.Viewer {
+	return types.Viewer{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Referrer:  c.Request.Referer(),
+	}
+}
+
+// managedFile loads the file in the URL for a management action. Its owner
+// may manage it, as may anyone presenting its X-Management-Token. Otherwise
+// the error response is written and nil returned.
+func (fc *FileController) managedFile(c *gin.Context) *types.File {
+	file, err := fileRepo.FindFileByCustomUrl(fc.app, c.Param("customUrl"))
+	if err != nil {
+		util.LogError(err, "Failed to find file", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return nil
+	}
+	if file == nil || file.DeletedAt != nil {
+		apierror.Abort(c, http.StatusNotFound, "File not found")
+		return nil
+	}
+
+	user := middleware.CurrentUser(c)
+	if user != nil && file.OwnerId != nil && *file.OwnerId == user.Id {
+		return file
+	}
+	if service.CheckManagementToken(file, c.GetHeader("X-Management-Token")) {
+		return file
+	}
+
+	apierror.Abort(c, http.StatusForbidden, "Not allowed to manage this file")
+	return nil
+}
+
 func (fc *FileController) TrackVisualization(c *gin.Context) {
 	customUrl := c.Param("customUrl")
 	if customUrl == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Custom URL parameter is required"})
+		apierror.Abort(c, http.StatusBadRequest, "Custom URL parameter is required")
+		return
+	}
+
+	if util.IsBot(c.Request.UserAgent()) {
+		c.JSON(http.StatusOK, gin.H{"message": "Crawler views are not tracked"})
 		return
 	}
 
 	fileService := service.NewFileService(fc.app)
-	err := fileService.TrackFileSettings(customUrl)
+	err := fileService.TrackFileSettings(customUrl, service.ViewerKey(fc.app, viewer(c)))
+	if errors.Is(err, service.ErrViewLimitReached) {
+		apierror.Abort(c, http.StatusGone, "File is no longer available")
+		return
+	}
 	if err != nil {
 		util.LogError(err, "Failed to track file visualization", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track file visualization"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to track file visualization")
 		return
 	}
 
@@ -257,35 +793,324 @@ func (fc *FileController) CleanupExpiredFiles(c *gin.Context) {
 	err := fileService.CleanupExpiredFiles()
 	if err != nil {
 		util.LogError(err, "Failed to cleanup expired files", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cleanup expired files"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to cleanup expired files")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Expired files cleanup completed"})
 }
 
-func (fc *FileController) AddDownload(c *gin.Context) {
+// Default seconds CDNs and browsers may cache public raw files, overridable
+// with RAW_CACHE_MAX_AGE
+const defaultRawCacheMaxAge = 86400
+
+// ServeRawFile streams the file itself from /i/:customUrl, optionally with
+// an extension appended, so it can be embedded directly. Range requests and
+// conditional requests are passed through to R2. Password-protected files
+// need an access token, and view limits are enforced like in the JSON API.
+// Responses are sandboxed so served content can never run on the API origin.
+func (fc *FileController) ServeRawFile(c *gin.Context) {
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+
+	file, err := fc.findRawFile(c.Param("customUrl"))
+	if err != nil {
+		util.LogError(err, "Failed to find file", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return
+	}
+
+	if !fc.checkFileAvailable(c, file) {
+		return
+	}
+
+	if file.Password != nil && !service.NewAccessTokenService(fc.app).Verify(accessToken(c, file), file) {
+		apierror.AbortWithDetails(c, http.StatusForbidden, "Password required", gin.H{"requiresPassword": true})
+		return
+	}
+
+	request := service.R2ObjectRequest{
+		Range:       c.GetHeader("Range"),
+		IfNoneMatch: c.GetHeader("If-None-Match"),
+	}
+	if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil {
+		request.IfModifiedSince = &since
+	}
+
+	// Players fetch media in several ranges and only the first counts as a
+	// view. When views are limited, later ranges are only free for a viewer
+	// who claimed a view within the unique view window, so skipping the
+	// first range never gets around the limit
+	crawler := util.IsBot(c.Request.UserAgent())
+	counted := !crawler && rangeStartsAtZero(request.Range)
+	viewerKey := service.ViewerKey(fc.app, viewer(c))
+
+	fileService := service.NewFileService(fc.app)
+	if !crawler && !counted && file.DeletesAfterVizualizations {
+		seen, err := fileService.ViewedRecently(file.CustomUrl, viewerKey)
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to get file")
+			return
+		}
+		counted = !seen
+	}
+
+	object, last, err := fileService.ServeFile(file, request, counted, crawler, viewerKey)
+	if errors.Is(err, service.ErrViewLimitReached) {
+		apierror.Abort(c, http.StatusGone, "File is no longer available")
+		return
+	}
+	if errors.Is(err, service.ErrHiddenFromCrawlers) {
+		apierror.Abort(c, http.StatusForbidden, err.Error())
+		return
+	}
+	switch service.R2Status(err) {
+	case 0:
+	case http.StatusNotModified:
+		c.Status(http.StatusNotModified)
+		return
+	case http.StatusRequestedRangeNotSatisfiable:
+		c.Header("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+		c.Status(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if err != nil {
+		util.LogError(err, "Failed to get file from R2", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get file")
+		return
+	}
+	defer object.Body.Close()
+
+	if counted {
+		service.NewAnalyticsService(fc.app).Record(file, types.EventView, viewer(c), nil)
+	}
+
+	contentType := file.Type
+	if object.ContentType != nil {
+		contentType = *object.ContentType
+	}
+	contentLength := int64(-1)
+	if object.ContentLength != nil {
+		contentLength = *object.ContentLength
+	}
+
+	headers := map[string]string{
+		"Accept-Ranges":          "bytes",
+		"Cache-Control":          fc.rawCacheControl(file),
+		"X-Content-Type-Options": "nosniff",
+	}
+	// Raw files share the API's origin and its cookies, so anything that
+	// could run script is downloaded instead of rendered
+	if !util.InlineMediaType(contentType) {
+		headers["Content-Disposition"] = util.AttachmentDisposition(file.OriginalName + util.ExtensionForType(contentType))
+	}
+	if object.ETag != nil {
+		headers["ETag"] = *object.ETag
+	}
+	if object.LastModified != nil {
+		headers["Last-Modified"] = object.LastModified.UTC().Format(http.TimeFormat)
+	}
+
+	status := http.StatusOK
+	if object.ContentRange != nil {
+		status = http.StatusPartialContent
+		headers["Content-Range"] = *object.ContentRange
+	}
+
+	c.DataFromReader(status, contentLength, contentType, object.Body, headers)
+
+	if last {
+		fileService.DeleteFile(file.CustomUrl)
+	}
+}
+
+// Bounds on how long a thumbnail request waits for the upload to be
+// processed, checking every thumbnailPollInterval.
+const (
+	thumbnailWait         = 15 * time.Second
+	thumbnailPollInterval = 250 * time.Millisecond
+)
+
+// ServeThumbnail streams the thumbnail of an image from
+// /i/:customUrl/thumbnail. It never counts a view, so password-protected and
+// view-limited files have none. Screenshot tools fetch it right after the
+// upload, so it waits for the upload to be processed for up to
+// thumbnailWait.
+func (fc *FileController) ServeThumbnail(c *gin.Context) {
+	c.Header("Content-Security-Policy", "default-src 'none'; sandbox")
+
+	file, err := fc.waitForProcessing(c, c.Param("customUrl"))
+	if err != nil {
+		util.LogError(err, "Failed to find file", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return
+	}
+
+	if !fc.checkFileAvailable(c, file) {
+		return
+	}
+
+	if file.Password != nil || file.DeletesAfterVizualizations || !service.HasThumbnail(file.Type) {
+		apierror.Abort(c, http.StatusNotFound, "Thumbnail not found")
+		return
+	}
+
+	object, err := service.NewR2Service(fc.app).GetFromR2Object(service.ThumbnailKey(file.CustomUrl), service.R2ObjectRequest{
+		IfNoneMatch: c.GetHeader("If-None-Match"),
+	})
+	switch service.R2Status(err) {
+	case 0:
+	case http.StatusNotModified:
+		c.Status(http.StatusNotModified)
+		return
+	case http.StatusNotFound:
+		apierror.Abort(c, http.StatusNotFound, "Thumbnail not found")
+		return
+	}
+	if err != nil {
+		util.LogError(err, "Failed to get thumbnail from R2", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get thumbnail")
+		return
+	}
+	defer object.Body.Close()
+
+	contentLength := int64(-1)
+	if object.ContentLength != nil {
+		contentLength = *object.ContentLength
+	}
+	headers := map[string]string{
+		"Cache-Control":          fc.rawCacheControl(file),
+		"X-Content-Type-Options": "nosniff",
+	}
+	if object.ETag != nil {
+		headers["ETag"] = *object.ETag
+	}
+
+	c.DataFromReader(http.StatusOK, contentLength, "image/jpeg", object.Body, headers)
+}
+
+// waitForProcessing finds the file, polling until it is no longer pending,
+// thumbnailWait has passed or the client went away.
+func (fc *FileController) waitForProcessing(c *gin.Context, customUrl string) (*types.File, error) {
+	deadline := time.Now().Add(thumbnailWait)
+	for {
+		file, err := fileRepo.FindFileByCustomUrl(fc.app, customUrl)
+		if err != nil || file == nil || file.Status != types.Pending || time.Now().After(deadline) {
+			return file, err
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return file, nil
+		case <-time.After(thumbnailPollInterval):
+		}
+	}
+}
+
+// findRawFile resolves the name in a raw URL, which is the customUrl
+// optionally followed by any extension.
+func (fc *FileController) findRawFile(name string) (*types.File, error) {
+	file, err := fileRepo.FindFileByCustomUrl(fc.app, name)
+	if err != nil || file != nil {
+		return file, err
+	}
+
+	ext := filepath.Ext(name)
+	if ext == "" {
+		return nil, nil
+	}
+	return fileRepo.FindFileByCustomUrl(fc.app, strings.TrimSuffix(name, ext))
+}
+
+// rawCacheControl lets shared caches keep public files until they expire,
+// while files behind a password or with limits are never stored.
+func (fc *FileController) rawCacheControl(file *types.File) string {
+	if file.Password != nil || file.DeletesAfterVizualizations || file.DeletesAfterDownload || file.ExpiresAfterViewSeconds != nil {
+		return "private, no-store"
+	}
+
+	maxAge := util.GetEnvInt("RAW_CACHE_MAX_AGE", defaultRawCacheMaxAge, fc.app)
+	if file.ExpiresIn != nil {
+		maxAge = min(maxAge, int64(time.Until(*file.ExpiresIn).Seconds()))
+	}
+	return fmt.Sprintf("public, max-age=%d", max(maxAge, 0))
+}
+
+// rangeStartsAtZero reports whether a Range header is absent or asks for the
+// start of the file.
+func rangeStartsAtZero(rangeHeader string) bool {
+	return rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-")
+}
+
+// DownloadFile streams the file as an attachment under its original name.
+// The download, and a view for view-limited files, is counted before
+// anything is sent, so limits can neither be skipped nor spent without
+// downloading.
+func (fc *FileController) DownloadFile(c *gin.Context) {
 	customUrl := c.Param("customUrl")
 	if customUrl == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Custom URL parameter is required"})
+		apierror.Abort(c, http.StatusBadRequest, "Custom URL parameter is required")
+		return
+	}
+
+	file, err := fileRepo.FindFileByCustomUrl(fc.app, customUrl)
+	if err != nil {
+		util.LogError(err, "Failed to find file", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return
+	}
+
+	if !fc.checkFileAvailable(c, file) {
+		return
+	}
+
+	if _, ok := fc.authorizeFileAccess(c, file); !ok {
 		return
 	}
 
+	crawler := util.IsBot(c.Request.UserAgent())
 	fileService := service.NewFileService(fc.app)
-	err := fileService.TrackFileDownload(customUrl)
+	object, last, err := fileService.DownloadFile(file, crawler, service.ViewerKey(fc.app, viewer(c)))
+	if errors.Is(err, service.ErrDownloadLimitReached) {
+		apierror.Abort(c, http.StatusGone, "File is no longer available")
+		return
+	}
+	if errors.Is(err, service.ErrHiddenFromCrawlers) {
+		apierror.Abort(c, http.StatusForbidden, err.Error())
+		return
+	}
 	if err != nil {
-		util.LogError(err, "Failed to track file download", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to track file download"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get file")
 		return
 	}
+	defer object.Body.Close()
 
-	c.JSON(http.StatusOK, gin.H{"message": "Download added successfully"})
+	if !crawler {
+		service.NewAnalyticsService(fc.app).Record(file, types.EventDownload, viewer(c), nil)
+	}
+
+	contentType := file.Type
+	if object.ContentType != nil {
+		contentType = *object.ContentType
+	}
+	contentLength := int64(-1)
+	if object.ContentLength != nil {
+		contentLength = *object.ContentLength
+	}
+
+	c.DataFromReader(http.StatusOK, contentLength, contentType, object.Body, map[string]string{
+		"Content-Disposition": util.AttachmentDisposition(file.OriginalName + util.ExtensionForType(contentType)),
+		"Cache-Control":       "private, no-store",
+	})
+
+	if last {
+		fileService.DeleteFile(customUrl)
+	}
 }
 
 func (fc *FileController) GetFileInfo(c *gin.Context) {
 	customUrl := c.Param("customUrl")
 	if customUrl == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Custom URL parameter is required"})
+		apierror.Abort(c, http.StatusBadRequest, "Custom URL parameter is required")
 		return
 	}
 
@@ -293,25 +1118,90 @@ func (fc *FileController) GetFileInfo(c *gin.Context) {
 	file, err := fileService.GetFileInfo(customUrl)
 	if err != nil {
 		util.LogError(err, "Failed to get file info", fc.app)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file info"})
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get file info")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	if file == nil {
+		apierror.Abort(c, http.StatusNotFound, "File not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, FileInfoResponse(file))
+}
+
+// FileInfoResponse is the public representation of a file's metadata. It
+// never links to the content, which is only handed out once access is
+// checked and a view claimed.
+func FileInfoResponse(file *types.File) gin.H {
+	return gin.H{
 		"customUrl":                  file.CustomUrl,
 		"originalName":               file.OriginalName,
 		"size":                       file.Size,
 		"type":                       file.Type,
 		"createdAt":                  file.CreatedAt,
 		"status":                     file.Status,
-		"path":                       file.Path,
 		"expiresIn":                  file.ExpiresIn,
+		"expiresAt":                  file.ExpiresIn,
+		"expiresAfterFirstView":      file.ExpiresAfterViewSeconds,
 		"deletedAt":                  file.DeletedAt,
+		"trashedAt":                  file.TrashedAt,
 		"vizualizations":             file.Vizualizations,
+		"uniqueVizualizations":       file.UniqueVizualizations,
+		"countUniqueViews":           file.CountUniqueViews,
 		"downloads":                  file.Downloads,
 		"deletesAfterDownload":       file.DeletesAfterDownload,
 		"downloadsForDeletion":       file.DownloadsForDeletion,
 		"deletesAfterVizualizations": file.DeletesAfterVizualizations,
 		"vizualizationsForDeletion":  file.VizualizationsForDeletion,
+		"duration":                   file.Duration,
+	}
+}
+
+func (fc *FileController) GetFileWaveform(c *gin.Context) {
+	customUrl := c.Param("customUrl")
+	if customUrl == "" {
+		apierror.Abort(c, http.StatusBadRequest, "Custom URL parameter is required")
+		return
+	}
+
+	file, err := fileRepo.FindFileByCustomUrl(fc.app, customUrl)
+	if err != nil {
+		util.LogError(err, "Failed to find file", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return
+	}
+
+	if !fc.checkFileAvailable(c, file) {
+		return
+	}
+
+	if _, ok := fc.authorizeFileAccess(c, file); !ok {
+		return
+	}
+
+	if !strings.HasPrefix(file.Type, "audio/") {
+		apierror.Abort(c, http.StatusNotFound, "Waveforms are only available for audio files")
+		return
+	}
+
+	r2 := service.NewR2Service(fc.app)
+	imageUrl, err := r2.GetFromR2(service.WaveformImageKey(customUrl))
+	if err != nil {
+		util.LogError(err, "Failed to get waveform image from R2", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get waveform")
+		return
+	}
+	peaksUrl, err := r2.GetFromR2(service.WaveformPeaksKey(customUrl))
+	if err != nil {
+		util.LogError(err, "Failed to get waveform peaks from R2", fc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to get waveform")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"duration": file.Duration,
+		"image":    imageUrl,
+		"peaks":    peaksUrl,
 	})
 }
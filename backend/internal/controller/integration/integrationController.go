@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"errors"
+	"gabrielsy/imgnow/internal/apierror"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/middleware"
+	"gabrielsy/imgnow/internal/service"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shareXConfig is a ShareX custom uploader (.sxcu) file. Flameshot and
+// other tools accepting the format can import it too.
+type shareXConfig struct {
+	Version         string            `json:"Version"`
+	Name            string            `json:"Name"`
+	DestinationType string            `json:"DestinationType"`
+	RequestMethod   string            `json:"RequestMethod"`
+	RequestURL      string            `json:"RequestURL"`
+	Headers         map[string]string `json:"Headers"`
+	Body            string            `json:"Body"`
+	FileFormName    string            `json:"FileFormName"`
+	URL             string            `json:"URL"`
+	ThumbnailURL    string            `json:"ThumbnailURL"`
+	DeletionURL     string            `json:"DeletionURL"`
+	ErrorMessage    string            `json:"ErrorMessage"`
+}
+
+type IntegrationController struct {
+	app *app.Application
+}
+
+func NewIntegrationController(app *app.Application) *IntegrationController {
+	return &IntegrationController{
+		app: app,
+	}
+}
+
+// ShareXConfig generates a ready to import ShareX uploader for the signed in
+// user. Every call issues a new upload-only API key, named after the name in
+// the optional JSON body, which can be revoked like any other key. It is a
+// POST so that nothing, such as a prefetched link, creates keys by merely
+// visiting it.
+func (ic *IntegrationController) ShareXConfig(c *gin.Context) {
+	var request types.ShareXConfigRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.Name == "" {
+		request.Name = "ShareX"
+	}
+
+	apiKeyService := service.NewAPIKeyService(ic.app)
+	_, secret, err := apiKeyService.CreateKey(middleware.CurrentUser(c), types.CreateAPIKeyRequest{
+		Name:   request.Name,
+		Scopes: []types.APIKeyScope{types.ScopeUpload},
+	})
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	config := shareXConfig{
+		Version:         "15.0.0",
+		Name:            "imgnow",
+		DestinationType: "ImageUploader, TextUploader, FileUploader",
+		RequestMethod:   "POST",
+		RequestURL:      util.PublicURL(c.Request, ic.app) + util.APIPrefix + "/file/upload",
+		Headers:         map[string]string{"Authorization": "Bearer " + secret},
+		Body:            "MultipartFormData",
+		FileFormName:    "file",
+		URL:             "{json:url}",
+		ThumbnailURL:    "{json:thumbnailUrl}",
+		DeletionURL:     "{json:deletionUrl}",
+		ErrorMessage:    "{json:error.message}",
+	}
+
+	c.Header("Content-Disposition", util.AttachmentDisposition("imgnow.sxcu"))
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, config)
+}
@@ -0,0 +1,391 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"gabrielsy/imgnow/internal/apierror"
+	"gabrielsy/imgnow/internal/app"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	"gabrielsy/imgnow/internal/service"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filePage is the data behind the preview page of a file. Media is only set
+// when the file may be previewed.
+type filePage struct {
+	Title       string
+	Description string
+	PageURL     string
+	ViewerURL   string
+	Card        string
+	MediaURL    string
+	MediaType   string
+	Kind        string
+	Width       *int
+	Height      *int
+	OEmbedURL   string
+}
+
+var filePageTemplate = template.Must(template.New("file").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<meta name="description" content="{{.Description}}">
+<meta property="og:site_name" content="imgnow">
+<meta property="og:title" content="{{.Title}}">
+<meta property="og:description" content="{{.Description}}">
+<meta property="og:url" content="{{.PageURL}}">
+{{- if eq .Kind "image"}}
+<meta property="og:type" content="website">
+<meta property="og:image" content="{{.MediaURL}}">
+<meta property="og:image:type" content="{{.MediaType}}">
+{{- with .Width}}
+<meta property="og:image:width" content="{{.}}">{{end}}
+{{- with .Height}}
+<meta property="og:image:height" content="{{.}}">{{end}}
+<meta name="twitter:image" content="{{.MediaURL}}">
+{{- else if eq .Kind "video"}}
+<meta property="og:type" content="video.other">
+<meta property="og:video" content="{{.MediaURL}}">
+<meta property="og:video:secure_url" content="{{.MediaURL}}">
+<meta property="og:video:type" content="{{.MediaType}}">
+{{- with .Width}}
+<meta property="og:video:width" content="{{.}}">{{end}}
+{{- with .Height}}
+<meta property="og:video:height" content="{{.}}">{{end}}
+{{- else if eq .Kind "audio"}}
+<meta property="og:type" content="music.song">
+<meta property="og:audio" content="{{.MediaURL}}">
+<meta property="og:audio:type" content="{{.MediaType}}">
+{{- else}}
+<meta property="og:type" content="website">
+{{- end}}
+<meta name="twitter:card" content="{{.Card}}">
+<meta name="twitter:title" content="{{.Title}}">
+<meta name="twitter:description" content="{{.Description}}">
+{{- with .OEmbedURL}}
+<link rel="alternate" type="application/json+oembed" href="{{.}}&format=json" title="{{$.Title}}">
+<link rel="alternate" type="text/xml+oembed" href="{{.}}&format=xml" title="{{$.Title}}">
+{{- end}}
+<meta http-equiv="refresh" content="0; url={{.ViewerURL}}">
+</head>
+<body>
+<p><a href="{{.ViewerURL}}">{{.Title}}</a></p>
+</body>
+</html>
+`))
+
+// deletePage is the data behind the page deletion links from uploaders like
+// ShareX open. Confirm shows the form, otherwise Message is the outcome.
+type deletePage struct {
+	Name    string
+	Token   string
+	Confirm bool
+	Message string
+}
+
+var deletePageTemplate = template.Must(template.New("delete").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Delete {{.Name}} - imgnow</title>
+</head>
+<body>
+{{- if .Confirm}}
+<form method="post">
+<p>Delete {{.Name}}? It can be restored with its management token for a while.</p>
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Delete</button>
+</form>
+{{- else}}
+<p>{{.Message}}</p>
+{{- end}}
+</body>
+</html>
+`))
+
+type PageController struct {
+	app *app.Application
+}
+
+func NewPageController(app *app.Application) *PageController {
+	return &PageController{
+		app: app,
+	}
+}
+
+// FilePage renders the link preview for GET /:customUrl. Crawlers read its
+// OpenGraph and Twitter card tags, browsers are sent on to the web app.
+// Rendering it never counts a view.
+func (pc *PageController) FilePage(c *gin.Context) {
+	customUrl := c.Param("customUrl")
+	page := filePage{
+		Title:       "imgnow",
+		Description: "File shared with imgnow",
+		PageURL:     util.PublicURL(c.Request, pc.app) + "/" + customUrl,
+		ViewerURL:   util.FrontendURL(pc.app) + "/" + customUrl,
+		Card:        "summary",
+	}
+
+	file, err := fileRepo.FindFileByCustomUrl(pc.app, customUrl)
+	if err != nil {
+		util.LogError(err, "Failed to find file", pc.app)
+		pc.render(c, http.StatusInternalServerError, page)
+		return
+	}
+	if file == nil || !isAvailable(file) {
+		pc.render(c, http.StatusNotFound, page)
+		return
+	}
+
+	// Protected and view-limited files get a generic card that reveals
+	// nothing about them, since unfurling would expose or spend them
+	if file.Password != nil || file.DeletesAfterVizualizations {
+		if file.Password != nil {
+			page.Title = "Protected file"
+			page.Description = "This file is password protected"
+		}
+		pc.render(c, http.StatusOK, page)
+		return
+	}
+
+	page.Title = file.OriginalName
+	page.Description = "Shared with imgnow"
+	page.MediaURL = util.PublicURL(c.Request, pc.app) + "/i/" + file.CustomUrl + util.ExtensionForType(file.Type)
+	page.MediaType = file.Type
+	page.Width = file.Width
+	page.Height = file.Height
+	page.Kind, _, _ = strings.Cut(file.Type, "/")
+	page.OEmbedURL = util.PublicURL(c.Request, pc.app) + util.APIPrefix + "/oembed?url=" + url.QueryEscape(page.PageURL)
+	if page.Kind == "image" {
+		page.Card = "summary_large_image"
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	pc.render(c, http.StatusOK, page)
+}
+
+// Size used for embedded players when a video's dimensions are unknown
+const (
+	defaultEmbedWidth  = 640
+	defaultEmbedHeight = 360
+	audioEmbedWidth    = 300
+	audioEmbedHeight   = 54
+)
+
+// OEmbed answers GET /api/v1/oembed?url= for the page, raw or web app URL of an
+// active file, as a photo, video or rich (audio) embed. format selects json
+// (the default) or xml, and maxwidth/maxheight scale the embed down.
+func (pc *PageController) OEmbed(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "xml" {
+		apierror.Abort(c, http.StatusNotImplemented, "format must be json or xml")
+		return
+	}
+
+	customUrl, ok := pc.customUrlFromLink(c.Request, c.Query("url"))
+	if !ok {
+		apierror.Abort(c, http.StatusNotFound, "URL is not an imgnow file")
+		return
+	}
+
+	file, err := fileRepo.FindFileByCustomUrl(pc.app, customUrl)
+	if err == nil && file == nil {
+		// Raw URLs may end with an extension
+		if ext := path.Ext(customUrl); ext != "" {
+			file, err = fileRepo.FindFileByCustomUrl(pc.app, strings.TrimSuffix(customUrl, ext))
+		}
+	}
+	if err != nil {
+		util.LogError(err, "Failed to find file", pc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return
+	}
+	if file == nil || !isAvailable(file) {
+		apierror.Abort(c, http.StatusNotFound, "File not found")
+		return
+	}
+	if file.Password != nil || file.DeletesAfterVizualizations {
+		apierror.Abort(c, http.StatusUnauthorized, "File cannot be embedded")
+		return
+	}
+
+	publicUrl := util.PublicURL(c.Request, pc.app)
+	mediaUrl := publicUrl + "/i/" + file.CustomUrl + util.ExtensionForType(file.Type)
+	embed := types.OEmbed{
+		Version:      "1.0",
+		Title:        file.OriginalName,
+		ProviderName: "imgnow",
+		ProviderURL:  publicUrl,
+		CacheAge:     300,
+	}
+
+	maxWidth, _ := strconv.Atoi(c.Query("maxwidth"))
+	maxHeight, _ := strconv.Atoi(c.Query("maxheight"))
+
+	kind, _, _ := strings.Cut(file.Type, "/")
+	switch {
+	case kind == "image" && file.Width != nil && file.Height != nil:
+		embed.Type = "photo"
+		embed.URL = mediaUrl
+		embed.Width, embed.Height = fitWithin(*file.Width, *file.Height, maxWidth, maxHeight)
+		embed.ThumbnailURL = mediaUrl
+		embed.ThumbnailWidth, embed.ThumbnailHeight = embed.Width, embed.Height
+	case kind == "video":
+		width, height := defaultEmbedWidth, defaultEmbedHeight
+		if file.Width != nil && file.Height != nil {
+			width, height = *file.Width, *file.Height
+		}
+		embed.Type = "video"
+		embed.Width, embed.Height = fitWithin(width, height, maxWidth, maxHeight)
+		embed.HTML = fmt.Sprintf(`<video src="%s" width="%d" height="%d" controls preload="metadata"></video>`,
+			html.EscapeString(mediaUrl), embed.Width, embed.Height)
+	case kind == "audio":
+		embed.Type = "rich"
+		embed.Width, embed.Height = fitWithin(audioEmbedWidth, audioEmbedHeight, maxWidth, 0)
+		embed.HTML = fmt.Sprintf(`<audio src="%s" controls preload="metadata" style="width:%dpx"></audio>`,
+			html.EscapeString(mediaUrl), embed.Width)
+	default:
+		// Images of unknown size cannot be photo embeds, which require one
+		embed.Type = "link"
+	}
+
+	if format == "xml" {
+		c.XML(http.StatusOK, embed)
+		return
+	}
+	c.JSON(http.StatusOK, embed)
+}
+
+// customUrlFromLink extracts the customUrl from an imgnow page, raw or web
+// app URL, rejecting URLs on other hosts.
+func (pc *PageController) customUrlFromLink(r *http.Request, link string) (string, bool) {
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host == "" {
+		return "", false
+	}
+
+	hosts := []string{util.PublicURL(r, pc.app), util.FrontendURL(pc.app)}
+	known := false
+	for _, host := range hosts {
+		if hostUrl, err := url.Parse(host); err == nil && strings.EqualFold(hostUrl.Host, parsed.Host) {
+			known = true
+		}
+	}
+	if !known {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(parsed.Path, "/"), "i/")
+	if name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+// DeletePage asks to confirm deleting a file from the deletion URL returned
+// on upload. Opening the link does nothing by itself, so link previews and
+// prefetching can't delete the file.
+func (pc *PageController) DeletePage(c *gin.Context) {
+	file, ok := pc.tokenFile(c, c.Query("token"))
+	if !ok {
+		return
+	}
+	pc.renderDelete(c, http.StatusOK, deletePage{Name: file.OriginalName, Token: c.Query("token"), Confirm: true})
+}
+
+// ConfirmDelete moves the file to the trash once the deletion page is
+// submitted.
+func (pc *PageController) ConfirmDelete(c *gin.Context) {
+	file, ok := pc.tokenFile(c, c.PostForm("token"))
+	if !ok {
+		return
+	}
+
+	trashService := service.NewTrashService(pc.app)
+	_, err := trashService.Trash(file.CustomUrl)
+	if err != nil && !errors.Is(err, service.ErrAlreadyTrashed) {
+		pc.renderDelete(c, http.StatusInternalServerError, deletePage{Message: "Failed to delete file"})
+		return
+	}
+	pc.renderDelete(c, http.StatusOK, deletePage{Message: "File deleted"})
+}
+
+// tokenFile loads the file in the URL if the management token matches,
+// otherwise it renders the failure and returns false.
+func (pc *PageController) tokenFile(c *gin.Context, token string) (*types.File, bool) {
+	file, err := fileRepo.FindFileByCustomUrl(pc.app, c.Param("customUrl"))
+	if err != nil {
+		util.LogError(err, "Failed to find file", pc.app)
+		pc.renderDelete(c, http.StatusInternalServerError, deletePage{Message: "Failed to find file"})
+		return nil, false
+	}
+	if file == nil || file.DeletedAt != nil || file.Status == types.Deleted {
+		pc.renderDelete(c, http.StatusNotFound, deletePage{Message: "File not found"})
+		return nil, false
+	}
+	if !service.CheckManagementToken(file, token) {
+		pc.renderDelete(c, http.StatusForbidden, deletePage{Message: "Invalid deletion link"})
+		return nil, false
+	}
+	if file.TrashedAt != nil {
+		pc.renderDelete(c, http.StatusOK, deletePage{Message: "File already deleted"})
+		return nil, false
+	}
+	return file, true
+}
+
+// fitWithin scales width and height down to fit the given maximums, keeping
+// the aspect ratio. Maximums of 0 are ignored.
+func fitWithin(width int, height int, maxWidth int, maxHeight int) (int, int) {
+	if maxWidth > 0 && width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if maxHeight > 0 && height > maxHeight {
+		width = width * maxHeight / height
+		height = maxHeight
+	}
+	return width, height
+}
+
+func (pc *PageController) render(c *gin.Context, status int, page filePage) {
+	if c.Writer.Header().Get("Cache-Control") == "" {
+		c.Header("Cache-Control", "no-cache")
+	}
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := filePageTemplate.Execute(c.Writer, page); err != nil {
+		util.LogError(err, "Failed to render file page", pc.app)
+	}
+}
+
+func (pc *PageController) renderDelete(c *gin.Context, status int, page deletePage) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := deletePageTemplate.Execute(c.Writer, page); err != nil {
+		util.LogError(err, "Failed to render delete page", pc.app)
+	}
+}
+
+func isAvailable(file *types.File) bool {
+	return file.Status == types.Active &&
+		file.DeletedAt == nil &&
+		file.TrashedAt == nil &&
+		(file.ExpiresIn == nil || file.ExpiresIn.After(time.Now()))
+}
@@ -0,0 +1,479 @@
+package controller
+
+import (
+	"errors"
+	"gabrielsy/imgnow/internal/apierror"
+	"gabrielsy/imgnow/internal/app"
+	fileController "gabrielsy/imgnow/internal/controller/file"
+	"gabrielsy/imgnow/internal/middleware"
+	service "gabrielsy/imgnow/internal/service"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPageSize = 100
+
+type UserController struct {
+	app *app.Application
+}
+
+func NewUserController(app *app.Application) *UserController {
+	return &UserController{
+		app: app,
+	}
+}
+
+func (uc *UserController) Register(c *gin.Context) {
+	var credentials types.Credentials
+	if err := c.ShouldBindJSON(&credentials); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userService := service.NewUserService(uc.app)
+	user, err := userService.Register(credentials)
+	if errors.Is(err, service.ErrEmailTaken) {
+		apierror.Abort(c, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, service.ErrPasswordTooLong) {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to register user")
+		return
+	}
+
+	c.JSON(http.StatusCreated, userResponse(user))
+}
+
+func (uc *UserController) Login(c *gin.Context) {
+	var credentials types.Credentials
+	if err := c.ShouldBindJSON(&credentials); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userService := service.NewUserService(uc.app)
+	user, token, err := userService.Login(credentials)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		apierror.Abort(c, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to log in")
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.SessionCookie, token, int(userService.SessionTTL().Seconds()), "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{
+		"user":  userResponse(user),
+		"token": token,
+	})
+}
+
+func (uc *UserController) Logout(c *gin.Context) {
+	token := middleware.RequestToken(c)
+	if token != "" {
+		userService := service.NewUserService(uc.app)
+		err := userService.Logout(token)
+		if err != nil {
+			util.LogError(err, "Failed to delete session", uc.app)
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
+	c.SetCookie(middleware.SessionCookie, "", -1, "/", "", c.Request.TLS != nil, true)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+func (uc *UserController) Me(c *gin.Context) {
+	c.JSON(http.StatusOK, userResponse(middleware.CurrentUser(c)))
+}
+
+// ListFiles returns the current user's files. Query parameters: type (a MIME
+// prefix such as "image" or "video/mp4"), status, from and to (RFC 3339 or
+// YYYY-MM-DD), page and pageSize.
+func (uc *UserController) ListFiles(c *gin.Context) {
+	filter, err := parseFileFilter(c)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userService := service.NewUserService(uc.app)
+	files, total, err := userService.ListFiles(middleware.CurrentUser(c), filter)
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list files")
+		return
+	}
+
+	items := make([]gin.H, 0, len(files))
+	for _, file := range files {
+		items = append(items, fileController.FileInfoResponse(file))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files":    items,
+		"page":     filter.Page,
+		"pageSize": filter.PageSize,
+		"total":    total,
+	})
+}
+
+func (uc *UserController) BulkUpdateSettings(c *gin.Context) {
+	var request types.BulkFileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if request.Settings == nil {
+		apierror.Abort(c, http.StatusBadRequest, "settings are required")
+		return
+	}
+
+	userService := service.NewUserService(uc.app)
+	files, err := userService.OwnedFiles(middleware.CurrentUser(c), request.CustomUrls)
+	if err != nil {
+		util.LogError(err, "Failed to load owned files", uc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to update files")
+		return
+	}
+
+	// Every file that was not updated is reported with the reason, so a
+	// partial update is never mistaken for a complete one
+	fileService := service.NewFileService(uc.app)
+	updated := []string{}
+	failed := []gin.H{}
+	owned := map[string]bool{}
+	for _, file := range files {
+		owned[file.CustomUrl] = true
+		err := fileService.HandleConfiguration(*request.Settings, file.CustomUrl)
+		if errors.Is(err, service.ErrInvalidSettings) {
+			failed = append(failed, gin.H{"customUrl": file.CustomUrl, "message": err.Error()})
+			continue
+		}
+		if err != nil {
+			util.LogError(err, "Failed to update file settings", uc.app)
+			failed = append(failed, gin.H{"customUrl": file.CustomUrl, "message": "Failed to update file settings"})
+			continue
+		}
+		updated = append(updated, file.CustomUrl)
+	}
+	for _, customUrl := range request.CustomUrls {
+		if !owned[customUrl] {
+			owned[customUrl] = true
+			failed = append(failed, gin.H{"customUrl": customUrl, "message": "File not found"})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": updated, "failed": failed})
+}
+
+func (uc *UserController) BulkDelete(c *gin.Context) {
+	var request types.BulkFileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userService := service.NewUserService(uc.app)
+	files, err := userService.OwnedFiles(middleware.CurrentUser(c), request.CustomUrls)
+	if err != nil {
+		util.LogError(err, "Failed to load owned files", uc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to delete files")
+		return
+	}
+
+	// Deleted files go to the trash like single deletes do
+	trashService := service.NewTrashService(uc.app)
+	deleted := []string{}
+	for _, file := range files {
+		_, err := trashService.Trash(file.CustomUrl)
+		if err != nil && !errors.Is(err, service.ErrAlreadyTrashed) {
+			util.LogError(err, "Failed to trash file", uc.app)
+			continue
+		}
+		deleted = append(deleted, file.CustomUrl)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
+
+func (uc *UserController) ListPasswordAttempts(c *gin.Context) {
+	file := uc.ownedFile(c)
+	if file == nil {
+		return
+	}
+
+	guard := service.NewPasswordGuardService(uc.app)
+	attempts, err := guard.ListAttempts(file)
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list password attempts")
+		return
+	}
+
+	items := make([]gin.H, 0, len(attempts))
+	for _, attempt := range attempts {
+		items = append(items, gin.H{
+			"ip":        attempt.IP,
+			"userAgent": attempt.UserAgent,
+			"createdAt": attempt.CreatedAt,
+			"clearedAt": attempt.ClearedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"attempts": items})
+}
+
+func (uc *UserController) UnlockFile(c *gin.Context) {
+	file := uc.ownedFile(c)
+	if file == nil {
+		return
+	}
+
+	guard := service.NewPasswordGuardService(uc.app)
+	if err := guard.Unlock(file); err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to unlock file")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "File unlocked"})
+}
+
+func (uc *UserController) CreateShareLink(c *gin.Context) {
+	file := uc.ownedFile(c)
+	if file == nil {
+		return
+	}
+
+	var request types.CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	shareLinkService := service.NewShareLinkService(uc.app)
+	link, err := shareLinkService.Create(file, request)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response, err := uc.shareLinkResponse(link)
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to sign share link")
+		return
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+func (uc *UserController) ListShareLinks(c *gin.Context) {
+	file := uc.ownedFile(c)
+	if file == nil {
+		return
+	}
+
+	shareLinkService := service.NewShareLinkService(uc.app)
+	links, err := shareLinkService.List(file)
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list share links")
+		return
+	}
+
+	items := make([]gin.H, 0, len(links))
+	for _, link := range links {
+		response, err := uc.shareLinkResponse(link)
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to sign share link")
+			return
+		}
+		items = append(items, response)
+	}
+	c.JSON(http.StatusOK, gin.H{"links": items})
+}
+
+func (uc *UserController) RevokeShareLink(c *gin.Context) {
+	file := uc.ownedFile(c)
+	if file == nil {
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid share link id")
+		return
+	}
+
+	shareLinkService := service.NewShareLinkService(uc.app)
+	err = shareLinkService.Revoke(file, id)
+	if errors.Is(err, service.ErrShareLinkNotFound) {
+		apierror.Abort(c, http.StatusNotFound, "Share link not found")
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to revoke share link")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share link revoked"})
+}
+
+func (uc *UserController) shareLinkResponse(link *types.ShareLink) (gin.H, error) {
+	shareLinkService := service.NewShareLinkService(uc.app)
+	token, err := shareLinkService.Token(link)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"id":               link.Id,
+		"label":            link.Label,
+		"token":            token,
+		"path":             util.APIPrefix + "/share/" + token,
+		"requiresPassword": link.Password != nil,
+		"maxViews":         link.MaxViews,
+		"views":            link.Views,
+		"expiresAt":        link.ExpiresAt,
+		"createdAt":        link.CreatedAt,
+		"lastViewedAt":     link.LastViewedAt,
+		"revokedAt":        link.RevokedAt,
+		"active":           service.IsShareLinkActive(link),
+	}, nil
+}
+
+// ownedFile loads the :customUrl file if it belongs to the current user,
+// otherwise it writes a 404 and returns nil.
+func (uc *UserController) ownedFile(c *gin.Context) *types.File {
+	userService := service.NewUserService(uc.app)
+	files, err := userService.OwnedFiles(middleware.CurrentUser(c), []string{c.Param("customUrl")})
+	if err != nil {
+		util.LogError(err, "Failed to load owned file", uc.app)
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to find file")
+		return nil
+	}
+	if len(files) == 0 {
+		apierror.Abort(c, http.StatusNotFound, "File not found")
+		return nil
+	}
+	return files[0]
+}
+
+func (uc *UserController) CreateAPIKey(c *gin.Context) {
+	var request types.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	apiKeyService := service.NewAPIKeyService(uc.app)
+	key, secret, err := apiKeyService.CreateKey(middleware.CurrentUser(c), request)
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response := apiKeyResponse(key)
+	response["key"] = secret
+	c.JSON(http.StatusCreated, response)
+}
+
+func (uc *UserController) ListAPIKeys(c *gin.Context) {
+	apiKeyService := service.NewAPIKeyService(uc.app)
+	keys, err := apiKeyService.ListKeys(middleware.CurrentUser(c))
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+
+	items := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, apiKeyResponse(key))
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": items})
+}
+
+func (uc *UserController) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid API key id")
+		return
+	}
+
+	apiKeyService := service.NewAPIKeyService(uc.app)
+	err = apiKeyService.RevokeKey(middleware.CurrentUser(c), id)
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		apierror.Abort(c, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+func apiKeyResponse(key *types.APIKey) gin.H {
+	scopes := key.Scopes
+	if len(scopes) == 0 {
+		scopes = types.AllScopes
+	}
+	return gin.H{
+		"id":         key.Id,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     scopes,
+		"createdAt":  key.CreatedAt,
+		"lastUsedAt": key.LastUsedAt,
+		"revokedAt":  key.RevokedAt,
+	}
+}
+
+func userResponse(user *types.User) gin.H {
+	return gin.H{
+		"id":        user.Id,
+		"email":     user.Email,
+		"createdAt": user.CreatedAt,
+	}
+}
+
+func parseFileFilter(c *gin.Context) (types.FileFilter, error) {
+	filter := types.FileFilter{
+		Type:     c.Query("type"),
+		Status:   types.FileStatus(c.Query("status")),
+		Trashed:  c.Query("trashed") == "true",
+		Page:     1,
+		PageSize: 20,
+	}
+
+	if page := c.Query("page"); page != "" {
+		parsed, err := strconv.Atoi(page)
+		if err != nil || parsed < 1 {
+			return filter, errors.New("page must be a positive integer")
+		}
+		filter.Page = parsed
+	}
+	if pageSize := c.Query("pageSize"); pageSize != "" {
+		parsed, err := strconv.Atoi(pageSize)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			return filter, errors.New("pageSize must be between 1 and 100")
+		}
+		filter.PageSize = parsed
+	}
+
+	var err error
+	if filter.CreatedAfter, err = util.ParseDate(c.Query("from")); err != nil {
+		return filter, errors.New("from must be a date")
+	}
+	if filter.CreatedBefore, err = util.ParseDate(c.Query("to")); err != nil {
+		return filter, errors.New("to must be a date")
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"gabrielsy/imgnow/internal/apierror"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/middleware"
+	"gabrielsy/imgnow/internal/service"
+	"gabrielsy/imgnow/internal/types"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	app *app.Application
+}
+
+func NewWebhookController(app *app.Application) *WebhookController {
+	return &WebhookController{
+		app: app,
+	}
+}
+
+// CreateWebhook registers an endpoint. The signing secret is only returned
+// here and when it is rotated.
+func (wc *WebhookController) CreateWebhook(c *gin.Context) {
+	var request types.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhookService := service.NewWebhookService(wc.app)
+	webhook, err := webhookService.CreateWebhook(middleware.CurrentUser(c), request)
+	if errors.Is(err, service.ErrInvalidWebhook) {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to create webhook")
+		return
+	}
+
+	response := webhookResponse(webhook)
+	response["secret"] = webhook.Secret
+	c.JSON(http.StatusCreated, response)
+}
+
+func (wc *WebhookController) ListWebhooks(c *gin.Context) {
+	webhookService := service.NewWebhookService(wc.app)
+	webhooks, err := webhookService.ListWebhooks(middleware.CurrentUser(c))
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, "Failed to list webhooks")
+		return
+	}
+
+	items := make([]gin.H, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		items = append(items, webhookResponse(webhook))
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": items})
+}
+
+func (wc *WebhookController) UpdateWebhook(c *gin.Context) {
+	id, ok := webhookId(c)
+	if !ok {
+		return
+	}
+
+	var request types.UpdateWebhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	webhookService := service.NewWebhookService(wc.app)
+	webhook, err := webhookService.UpdateWebhook(middleware.CurrentUser(c), id, request)
+	if webhookError(c, err, "Failed to update webhook") {
+		return
+	}
+
+	response := webhookResponse(webhook)
+	if request.RotateSecret {
+		response["secret"] = webhook.Secret
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (wc *WebhookController) DeleteWebhook(c *gin.Context) {
+	id, ok := webhookId(c)
+	if !ok {
+		return
+	}
+
+	webhookService := service.NewWebhookService(wc.app)
+	err := webhookService.DeleteWebhook(middleware.CurrentUser(c), id)
+	if webhookError(c, err, "Failed to delete webhook") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// ListDeliveries returns the webhook's delivery log, newest first, up to
+// ?limit entries.
+func (wc *WebhookController) ListDeliveries(c *gin.Context) {
+	id, ok := webhookId(c)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			apierror.Abort(c, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+	}
+
+	webhookService := service.NewWebhookService(wc.app)
+	deliveries, err := webhookService.Deliveries(middleware.CurrentUser(c), id, limit)
+	if webhookError(c, err, "Failed to list webhook deliveries") {
+		return
+	}
+
+	items := make([]gin.H, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		items = append(items, deliveryResponse(delivery))
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": items})
+}
+
+// TestWebhook sends a webhook.test event to the endpoint and responds with
+// the resulting delivery, whether or not the endpoint accepted it.
+func (wc *WebhookController) TestWebhook(c *gin.Context) {
+	id, ok := webhookId(c)
+	if !ok {
+		return
+	}
+
+	webhookService := service.NewWebhookService(wc.app)
+	delivery, err := webhookService.Test(middleware.CurrentUser(c), id)
+	if webhookError(c, err, "Failed to send test event") {
+		return
+	}
+
+	c.JSON(http.StatusOK, deliveryResponse(delivery))
+}
+
+func webhookId(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "Invalid webhook id")
+		return 0, false
+	}
+	return id, true
+}
+
+// webhookError writes the response for a failed webhook operation and
+// reports whether there was an error.
+func webhookError(c *gin.Context, err error, message string) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, service.ErrWebhookNotFound):
+		apierror.Abort(c, http.StatusNotFound, "Webhook not found")
+	case errors.Is(err, service.ErrInvalidWebhook):
+		apierror.Abort(c, http.StatusBadRequest, err.Error())
+	default:
+		apierror.Abort(c, http.StatusInternalServerError, message)
+	}
+	return true
+}
+
+func webhookResponse(webhook *types.Webhook) gin.H {
+	return gin.H{
+		"id":        webhook.Id,
+		"url":       webhook.Url,
+		"events":    webhook.Events,
+		"active":    webhook.Active,
+		"createdAt": webhook.CreatedAt,
+	}
+}
+
+func deliveryResponse(delivery *types.WebhookDelivery) gin.H {
+	return gin.H{
+		"id":             delivery.Id,
+		"event":          delivery.Event,
+		"status":         delivery.Status,
+		"attempts":       delivery.Attempts,
+		"nextAttemptAt":  delivery.NextAttemptAt,
+		"responseStatus": delivery.ResponseStatus,
+		"responseBody":   delivery.ResponseBody,
+		"error":          delivery.Error,
+		"payload":        json.RawMessage(delivery.Payload),
+		"createdAt":      delivery.CreatedAt,
+		"deliveredAt":    delivery.DeliveredAt,
+	}
+}
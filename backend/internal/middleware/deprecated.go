@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeprecatedAlias marks responses served under a deprecated prefix, pointing
+// clients to the same path under its successor.
+func DeprecatedAlias(prefix string, successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Deprecation", "true")
+		if path, ok := strings.CutPrefix(c.Request.URL.Path, prefix); ok {
+			c.Header("Link", "<"+successor+path+`>; rel="successor-version"`)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"fmt"
+	"gabrielsy/imgnow/internal/apierror"
+	"gabrielsy/imgnow/internal/app"
+	service "gabrielsy/imgnow/internal/service"
+	"gabrielsy/imgnow/internal/util"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const quotaRemainingKey = "quotaRemainingBytes"
+
+// Identity is the key requests are rate limited by: the API key when one is
+// used, otherwise the logged-in user, otherwise the client IP.
+func Identity(c *gin.Context) string {
+	if key := CurrentAPIKey(c); key != nil {
+		return fmt.Sprintf("key:%d", key.Id)
+	}
+	return UploaderIdentity(c)
+}
+
+// UploaderIdentity is the key uploads count against for quotas. Uploads made
+// with an API key count against its owner.
+func UploaderIdentity(c *gin.Context) string {
+	if user := CurrentUser(c); user != nil {
+		return fmt.Sprintf("user:%d", user.Id)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimit applies limit per Identity. When is optional and restricts the
+// limit to matching requests. Store failures let the request through.
+func RateLimit(app *app.Application, store service.RateLimitStore, limit service.RateLimit, when func(c *gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if when != nil && !when(c) {
+			c.Next()
+			return
+		}
+
+		result, err := store.Take(limit, Identity(c))
+		if err != nil {
+			util.LogError(err, "Failed to check rate limit", app)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", seconds(result.Reset))
+
+		if !result.Allowed {
+			c.Header("Retry-After", seconds(result.RetryAfter))
+			apierror.Abort(c, http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasBody matches requests that carry a body, such as password submissions.
+func HasBody(c *gin.Context) bool {
+	return c.Request.ContentLength != 0
+}
+
+// UploadQuota rejects uploads from identities over their daily file quota or
+// storage quota, and records the bytes they may still store for the handler.
+func UploadQuota(app *app.Application) gin.HandlerFunc {
+	quotaService := service.NewQuotaService(app)
+
+	return func(c *gin.Context) {
+		usage, err := quotaService.Usage(UploaderIdentity(c))
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, "Failed to check upload quota")
+			return
+		}
+
+		c.Header("X-Quota-Bytes-Limit", strconv.FormatInt(usage.BytesLimit, 10))
+		c.Header("X-Quota-Bytes-Used", strconv.FormatInt(usage.BytesUsed, 10))
+		c.Header("X-Quota-Files-Limit", strconv.Itoa(usage.FilesLimit))
+		c.Header("X-Quota-Files-Used", strconv.Itoa(usage.FilesToday))
+
+		if service.FilesExceeded(usage) {
+			c.Header("Retry-After", seconds(usage.RetryAfter))
+			apierror.Abort(c, http.StatusTooManyRequests, "Daily upload quota exceeded")
+			return
+		}
+
+		remaining := service.RemainingBytes(usage)
+		if remaining == 0 || (remaining > 0 && c.Request.ContentLength > remaining) {
+			apierror.Abort(c, http.StatusTooManyRequests, "Storage quota exceeded")
+			return
+		}
+
+		c.Set(quotaRemainingKey, remaining)
+		c.Next()
+	}
+}
+
+// RemainingQuotaBytes returns the bytes UploadQuota allows this request to
+// store, or -1 when unlimited.
+func RemainingQuotaBytes(c *gin.Context) int64 {
+	remaining, ok := c.Get(quotaRemainingKey)
+	if !ok {
+		return -1
+	}
+	return remaining.(int64)
+}
+
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"errors"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/service"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeStore answers every Take with result and err, recording the keys.
+type fakeStore struct {
+	result service.RateLimitResult
+	err    error
+	keys   []string
+}
+
+func (fs *fakeStore) Take(limit service.RateLimit, key string) (service.RateLimitResult, error) {
+	fs.keys = append(fs.keys, key)
+	return fs.result, fs.err
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testApp := &app.Application{Logger: log.New(io.Discard, "", 0)}
+	limit := service.RateLimit{Name: "test", PerMinute: 60, Burst: 5}
+
+	tests := []struct {
+		name    string
+		store   *fakeStore
+		when    func(c *gin.Context) bool
+		body    string
+		status  int
+		headers map[string]string
+		taken   bool
+	}{
+		{
+			name:   "allowed",
+			store:  &fakeStore{result: service.RateLimitResult{Allowed: true, Remaining: 4, Reset: 1500 * time.Millisecond}},
+			status: http.StatusOK,
+			headers: map[string]string{
+				"X-RateLimit-Limit":     "5",
+				"X-RateLimit-Remaining": "4",
+				"X-RateLimit-Reset":     "2",
+				"Retry-After":           "",
+			},
+			taken: true,
+		},
+		{
+			name:   "limited",
+			store:  &fakeStore{result: service.RateLimitResult{Allowed: false, RetryAfter: 250 * time.Millisecond, Reset: 5 * time.Second}},
+			status: http.StatusTooManyRequests,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     "5",
+				"Retry-After":           "1",
+			},
+			taken: true,
+		},
+		{
+			name:    "store failure lets the request through",
+			store:   &fakeStore{err: errors.New("database is down")},
+			status:  http.StatusOK,
+			headers: map[string]string{"X-RateLimit-Limit": ""},
+			taken:   true,
+		},
+		{
+			name:    "skipped when not matching",
+			store:   &fakeStore{result: service.RateLimitResult{Allowed: false}},
+			when:    HasBody,
+			status:  http.StatusOK,
+			headers: map[string]string{"X-RateLimit-Limit": ""},
+			taken:   false,
+		},
+		{
+			name:   "applied when matching",
+			store:  &fakeStore{result: service.RateLimitResult{Allowed: false, RetryAfter: time.Second}},
+			when:   HasBody,
+			body:   `{"password":"hunter22"}`,
+			status: http.StatusTooManyRequests,
+			taken:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.POST("/", RateLimit(testApp, tt.store, limit, tt.when), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			request.RemoteAddr = "192.0.2.1:1234"
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			for header, want := range tt.headers {
+				if got := recorder.Header().Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+			if taken := len(tt.store.keys) > 0; taken != tt.taken {
+				t.Errorf("token taken = %v, want %v", taken, tt.taken)
+			}
+			if tt.taken && tt.store.keys[0] != "ip:192.0.2.1" {
+				t.Errorf("key = %q, want the client IP", tt.store.keys[0])
+			}
+		})
+	}
+}
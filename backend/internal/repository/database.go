@@ -2,11 +2,16 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
+// uniqueViolation is the Postgres error code for a broken unique constraint.
+const uniqueViolation = "23505"
+
 func OpenDB() (*sql.DB, error) {
 	db, err := sql.Open("pgx", "host=localhost user=postgres password=postgres dbname=imgnow port=5432 sslmode=disable")
 	if err != nil {
@@ -14,3 +19,10 @@ func OpenDB() (*sql.DB, error) {
 	}
 	return db, nil
 }
+
+// IsUniqueViolation reports whether err comes from a write that broke a
+// unique constraint.
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"fmt"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/types"
+	"time"
+)
+
+func RecordFileEvent(app *app.Application, event *types.FileEvent) error {
+	query := `INSERT INTO file_event (file_id, kind, share_link_id, referrer_host, client_class, country)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := app.DB.Exec(query, event.FileId, event.Kind, event.ShareLinkId, event.ReferrerHost, event.ClientClass, event.Country)
+	return err
+}
+
+// GetFileEventSeries counts a file's views and downloads per interval
+// ("hour" or "day") between from and to, including empty buckets.
+func GetFileEventSeries(app *app.Application, fileId int, interval string, from time.Time, to time.Time) ([]types.StatsBucket, error) {
+	query := `SELECT b.start,
+			COUNT(e.id) FILTER (WHERE e.kind = $5),
+			COUNT(e.id) FILTER (WHERE e.kind = $6)
+		FROM generate_series(date_trunc($2, $3::timestamp), $4::timestamp, ('1 ' || $2)::interval) AS b(start)
+		LEFT JOIN file_event e ON e.file_id = $1
+			AND e.created_at >= b.start
+			AND e.created_at < b.start + ('1 ' || $2)::interval
+		GROUP BY b.start
+		ORDER BY b.start`
+
+	rows, err := app.DB.Query(query, fileId, interval, from, to, types.EventView, types.EventDownload)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	series := []types.StatsBucket{}
+	for rows.Next() {
+		var bucket types.StatsBucket
+		if err := rows.Scan(&bucket.Start, &bucket.Views, &bucket.Downloads); err != nil {
+			return nil, err
+		}
+		series = append(series, bucket)
+	}
+
+	return series, rows.Err()
+}
+
+var breakdownColumns = map[string]bool{
+	"country":       true,
+	"referrer_host": true,
+	"client_class":  true,
+}
+
+// GetFileEventBreakdown returns the most common values of an event column
+// among a file's views between from and to.
+func GetFileEventBreakdown(app *app.Application, fileId int, column string, from time.Time, to time.Time, limit int) ([]types.StatsCount, error) {
+	if !breakdownColumns[column] {
+		return nil, fmt.Errorf("unknown breakdown column %q", column)
+	}
+
+	query := `SELECT ` + column + `, COUNT(*) FROM file_event
+		WHERE file_id = $1 AND kind = $2 AND created_at >= $3 AND created_at < $4 AND ` + column + ` IS NOT NULL
+		GROUP BY ` + column + `
+		ORDER BY COUNT(*) DESC, ` + column + `
+		LIMIT $5`
+
+	rows, err := app.DB.Query(query, fileId, types.EventView, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []types.StatsCount{}
+	for rows.Next() {
+		var count types.StatsCount
+		if err := rows.Scan(&count.Value, &count.Count); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+func DeleteFileEventsBefore(app *app.Application, before time.Time) (int64, error) {
+	result, err := app.DB.Exec(`DELETE FROM file_event WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -1,14 +1,73 @@
 package repository
 
 import (
+	"database/sql"
+	"fmt"
 	"gabrielsy/imgnow/internal/app"
 	"gabrielsy/imgnow/internal/types"
 	"gabrielsy/imgnow/internal/util"
+	"strings"
 	"time"
 )
 
+// fileColumns lists the columns read into types.File, in the order scanFile
+// expects them.
+const fileColumns = `id, custom_url, path, original_name, size, type, created_at, status,
+	vizualizations, deletes_after_download, deleted_at, downloads_for_deletion,
+	deletes_after_vizualizations, vizualizations_for_deletion, last_vizualization,
+	expires_in, downloads, password, duration, owner_id, uploader, expires_after_view_seconds,
+	trashed_at, management_token_hash, unique_vizualizations, count_unique_views,
+	width, height`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// querier runs a query either directly or inside a transaction.
+type querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func scanFile(row scanner) (*types.File, error) {
+	var file types.File
+	err := row.Scan(
+		&file.Id,
+		&file.CustomUrl,
+		&file.Path,
+		&file.OriginalName,
+		&file.Size,
+		&file.Type,
+		&file.CreatedAt,
+		&file.Status,
+		&file.Vizualizations,
+		&file.DeletesAfterDownload,
+		&file.DeletedAt,
+		&file.DownloadsForDeletion,
+		&file.DeletesAfterVizualizations,
+		&file.VizualizationsForDeletion,
+		&file.LastVizualization,
+		&file.ExpiresIn,
+		&file.Downloads,
+		&file.Password,
+		&file.Duration,
+		&file.OwnerId,
+		&file.Uploader,
+		&file.ExpiresAfterViewSeconds,
+		&file.TrashedAt,
+		&file.ManagementTokenHash,
+		&file.UniqueVizualizations,
+		&file.CountUniqueViews,
+		&file.Width,
+		&file.Height,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
 func FindFileByCustomUrl(app *app.Application, customUrl string) (*types.File, error) {
-	query := `SELECT * FROM file WHERE custom_url = $1`
+	query := `SELECT ` + fileColumns + ` FROM file WHERE custom_url = $1`
 
 	rows, err := app.DB.Query(query, customUrl)
 
@@ -19,38 +78,31 @@ func FindFileByCustomUrl(app *app.Application, customUrl string) (*types.File, e
 	defer rows.Close()
 
 	for rows.Next() {
-		var file types.File
-		err := rows.Scan(
-			&file.Id,
-			&file.CustomUrl,
-			&file.Path,
-			&file.OriginalName,
-			&file.Size,
-			&file.Type,
-			&file.CreatedAt,
-			&file.Status,
-			&file.Vizualizations,
-			&file.DeletesAfterDownload,
-			&file.DeletedAt,
-			&file.DownloadsForDeletion,
-			&file.DeletesAfterVizualizations,
-			&file.VizualizationsForDeletion,
-			&file.LastVizualization,
-			&file.ExpiresIn,
-			&file.Downloads,
-			&file.Password,
-		)
+		file, err := scanFile(rows)
 		if err != nil {
 			return nil, err
 		}
-		return &file, nil
+		return file, nil
 	}
 
 	return nil, nil
 }
 
+func FindFileById(app *app.Application, id int) (*types.File, error) {
+	query := `SELECT ` + fileColumns + ` FROM file WHERE id = $1`
+
+	file, err := scanFile(app.DB.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return file, err
+}
+
 func CreateFile(app *app.Application, file *types.File) error {
-	query := `INSERT INTO file (custom_url, original_name, size, type, created_at, status) VALUES ($1, $2, $3, $4, $5, $6)`
+	query := `INSERT INTO file (custom_url, original_name, size, type, created_at, status, owner_id, uploader, expires_in, expires_after_view_seconds,
+		deletes_after_vizualizations, vizualizations_for_deletion, management_token_hash, count_unique_views,
+		deletes_after_download, downloads_for_deletion, password)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
 
 	tx, err := app.DB.Begin()
 	if err != nil {
@@ -58,7 +110,9 @@ func CreateFile(app *app.Application, file *types.File) error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(query, file.CustomUrl, file.OriginalName, file.Size, file.Type, file.CreatedAt, file.Status)
+	_, err = tx.Exec(query, file.CustomUrl, file.OriginalName, file.Size, file.Type, file.CreatedAt, file.Status, file.OwnerId, file.Uploader, file.ExpiresIn, file.ExpiresAfterViewSeconds,
+		file.DeletesAfterVizualizations, file.VizualizationsForDeletion, file.ManagementTokenHash, file.CountUniqueViews,
+		file.DeletesAfterDownload, file.DownloadsForDeletion, file.Password)
 	if err != nil {
 		return err
 	}
@@ -70,6 +124,83 @@ func CreateFile(app *app.Application, file *types.File) error {
 	return nil
 }
 
+// ListFilesByOwner returns one page of the owner's files, newest first, along
+// with the total number of files matching the filter.
+func ListFilesByOwner(app *app.Application, ownerId int, filter types.FileFilter) ([]*types.File, int, error) {
+	where := []string{"owner_id = $1", "deleted_at IS NULL"}
+	args := []any{ownerId}
+
+	if filter.Type != "" {
+		args = append(args, filter.Type+"%")
+		where = append(where, fmt.Sprintf("type LIKE $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		where = append(where, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, *filter.CreatedBefore)
+		where = append(where, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if filter.Trashed {
+		where = append(where, "trashed_at IS NOT NULL")
+	} else {
+		where = append(where, "trashed_at IS NULL")
+	}
+	conditions := strings.Join(where, " AND ")
+
+	var total int
+	err := app.DB.QueryRow(`SELECT COUNT(*) FROM file WHERE `+conditions, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.PageSize, (filter.Page-1)*filter.PageSize)
+	query := fmt.Sprintf(`SELECT `+fileColumns+` FROM file WHERE %s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d`, conditions, len(args)-1, len(args))
+
+	rows, err := app.DB.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	files := []*types.File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		files = append(files, file)
+	}
+
+	return files, total, rows.Err()
+}
+
+// GetUploaderUsage returns the bytes an uploader currently stores and how many
+// files they uploaded since the given time, with the oldest of those uploads.
+func GetUploaderUsage(app *app.Application, uploader string, since time.Time) (int64, int, *time.Time, error) {
+	query := `SELECT
+			COALESCE(SUM(size) FILTER (WHERE deleted_at IS NULL), 0),
+			COUNT(*) FILTER (WHERE created_at >= $2),
+			MIN(created_at) FILTER (WHERE created_at >= $2)
+		FROM file WHERE uploader = $1`
+
+	var bytesUsed int64
+	var files int
+	var oldest *time.Time
+	err := app.DB.QueryRow(query, uploader, since).Scan(&bytesUsed, &files, &oldest)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return bytesUsed, files, oldest, nil
+}
+
 func CustomUrlExists(app *app.Application, customUrl string) (bool, error) {
 	file, err := FindFileByCustomUrl(app, customUrl)
 	if err != nil {
@@ -110,23 +241,211 @@ func UpdateFilePath(app *app.Application, customUrl string, path string) error {
 	return nil
 }
 
-func IncrementVizualizations(app *app.Application, customUrl string) error {
+func UpdateFileType(app *app.Application, customUrl string, contentType string) error {
+	query := `UPDATE file SET type = $1 WHERE custom_url = $2`
+
+	_, err := app.DB.Exec(query, contentType, customUrl)
+	return err
+}
+
+func UpdateFileMedia(app *app.Application, customUrl string, contentType string, duration float64) error {
+	query := `UPDATE file 
+		SET type = $1,
+			duration = $2
+		WHERE custom_url = $3`
+
+	_, err := app.DB.Exec(query, contentType, duration, customUrl)
+	return err
+}
+
+func UpdateFileDimensions(app *app.Application, customUrl string, width int, height int) error {
+	query := `UPDATE file 
+		SET width = $1,
+			height = $2
+		WHERE custom_url = $3`
+
+	_, err := app.DB.Exec(query, width, height, customUrl)
+	return err
+}
+
+// ClaimVizualization counts a view, but only while the file is not deleted
+// and has views left, so concurrent viewers cannot both take the last view.
+// The viewer is unique unless viewerHash was already seen within window, and
+// files counting unique views only spend a view on unique viewers. It
+// reports whether a view was claimed and whether it was the file's last one.
+// On the first view of a file that expires relative to it, the expiry is
+// set, never past an earlier one.
+func ClaimVizualization(app *app.Application, customUrl string, viewerHash string, window time.Duration) (claimed bool, last bool, err error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return false, false, err
+	}
+	defer tx.Rollback()
+
+	claimed, last, err = claimVizualization(tx, customUrl, viewerHash, window)
+	if err != nil || !claimed {
+		return false, false, err
+	}
+	return true, last, tx.Commit()
+}
+
+func claimVizualization(tx *sql.Tx, customUrl string, viewerHash string, window time.Duration) (claimed bool, last bool, err error) {
+	viewerQuery := `INSERT INTO file_viewer (file_id, viewer_hash)
+		SELECT id, $2 FROM file WHERE custom_url = $1
+		ON CONFLICT (file_id, viewer_hash) DO UPDATE SET seen_at = CURRENT_TIMESTAMP
+			WHERE file_viewer.seen_at < CURRENT_TIMESTAMP - make_interval(secs => $3)
+		RETURNING true`
+
+	var unique bool
+	err = tx.QueryRow(viewerQuery, customUrl, viewerHash, window.Seconds()).Scan(&unique)
+	if err != nil && err != sql.ErrNoRows {
+		return false, false, err
+	}
+
 	query := `UPDATE file 
 		SET vizualizations = vizualizations + 1,
-			last_vizualization = CURRENT_TIMESTAMP
-		WHERE custom_url = $1`
+			unique_vizualizations = unique_vizualizations + CASE WHEN $2 THEN 1 ELSE 0 END,
+			last_vizualization = CURRENT_TIMESTAMP,
+			expires_in = CASE
+				WHEN last_vizualization IS NULL AND expires_after_view_seconds IS NOT NULL
+				THEN LEAST(COALESCE(expires_in, 'infinity'), CURRENT_TIMESTAMP + make_interval(secs => expires_after_view_seconds))
+				ELSE expires_in
+			END
+		WHERE custom_url = $1
+			AND deleted_at IS NULL
+			AND trashed_at IS NULL
+			AND (NOT deletes_after_vizualizations
+				OR vizualizations_for_deletion IS NULL
+				OR CASE WHEN count_unique_views
+					THEN NOT $2 OR unique_vizualizations < vizualizations_for_deletion
+					ELSE vizualizations < vizualizations_for_deletion
+				END)
+		RETURNING deletes_after_vizualizations
+			AND vizualizations_for_deletion IS NOT NULL
+			AND CASE WHEN count_unique_views
+				THEN $2 AND unique_vizualizations >= vizualizations_for_deletion
+				ELSE vizualizations >= vizualizations_for_deletion
+			END`
+
+	err = tx.QueryRow(query, customUrl, unique).Scan(&last)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, last, nil
+}
 
-	_, err := app.DB.Exec(query, customUrl)
+// ClaimDownload counts a download while the file is not deleted and has
+// downloads left, checking and incrementing in one statement. It reports
+// whether a download was claimed and whether it was the file's last one.
+func ClaimDownload(app *app.Application, customUrl string) (claimed bool, last bool, err error) {
+	return claimDownload(app.DB, customUrl)
+}
+
+// ClaimViewedDownload claims a view together with the download, for files
+// with a view limit, so downloading never gets around it. Neither is
+// counted unless both can be. last reports whether either limit was reached.
+func ClaimViewedDownload(app *app.Application, customUrl string, viewerHash string, window time.Duration) (claimed bool, last bool, err error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return false, false, err
+	}
+	defer tx.Rollback()
+
+	claimed, lastView, err := claimVizualization(tx, customUrl, viewerHash, window)
+	if err != nil || !claimed {
+		return false, false, err
+	}
+	claimed, lastDownload, err := claimDownload(tx, customUrl)
+	if err != nil || !claimed {
+		return false, false, err
+	}
+	return true, lastView || lastDownload, tx.Commit()
+}
+
+func claimDownload(db querier, customUrl string) (claimed bool, last bool, err error) {
+	query := `UPDATE file 
+		SET downloads = downloads + 1
+		WHERE custom_url = $1
+			AND deleted_at IS NULL
+			AND trashed_at IS NULL
+			AND (NOT deletes_after_download
+				OR downloads_for_deletion IS NULL
+				OR downloads < downloads_for_deletion)
+		RETURNING deletes_after_download
+			AND downloads_for_deletion IS NOT NULL
+			AND downloads >= downloads_for_deletion`
+
+	err = db.QueryRow(query, customUrl).Scan(&last)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, last, nil
+}
+
+// ViewerSeenSince reports whether the viewer claimed a view of the file
+// within the last window.
+func ViewerSeenSince(app *app.Application, customUrl string, viewerHash string, window time.Duration) (bool, error) {
+	query := `SELECT EXISTS (
+		SELECT 1 FROM file_viewer
+		JOIN file ON file.id = file_viewer.file_id
+		WHERE file.custom_url = $1
+			AND file_viewer.viewer_hash = $2
+			AND file_viewer.seen_at >= CURRENT_TIMESTAMP - make_interval(secs => $3)
+	)`
+
+	var seen bool
+	err := app.DB.QueryRow(query, customUrl, viewerHash, window.Seconds()).Scan(&seen)
+	return seen, err
+}
+
+func DeleteFileViewersBefore(app *app.Application, before time.Time) error {
+	_, err := app.DB.Exec(`DELETE FROM file_viewer WHERE seen_at < $1`, before)
 	return err
 }
 
+func UpdateCountUniqueViews(app *app.Application, customUrl string, countUniqueViews bool) error {
+	query := `UPDATE file 
+		SET count_unique_views = $1
+		WHERE custom_url = $2`
+
+	_, err := app.DB.Exec(query, countUniqueViews, customUrl)
+	return err
+}
+
+// ClaimExpiredFile marks a file whose expiry has passed as deleted, unless it
+// already is, in one statement. Only the caller that gets true goes on to
+// remove it, so concurrent requests never expire a file twice.
+func ClaimExpiredFile(app *app.Application, customUrl string) (bool, error) {
+	query := `UPDATE file 
+		SET deleted_at = CURRENT_TIMESTAMP,
+			status = $1
+		WHERE custom_url = $2
+			AND deleted_at IS NULL
+			AND expires_in IS NOT NULL
+			AND expires_in <= CURRENT_TIMESTAMP
+		RETURNING true`
+
+	var claimed bool
+	err := app.DB.QueryRow(query, types.Deleted, customUrl).Scan(&claimed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return claimed, err
+}
+
 func MarkFileAsDeleted(app *app.Application, customUrl string) error {
 	query := `UPDATE file 
 		SET deleted_at = CURRENT_TIMESTAMP,
 			status = $1
 		WHERE custom_url = $2`
 
-	_, err := app.DB.Exec(query, types.Error, customUrl)
+	_, err := app.DB.Exec(query, types.Deleted, customUrl)
 	return err
 }
 
@@ -150,39 +469,6 @@ func UpdateDeletionVizualizationSettings(app *app.Application, customUrl string,
 	return err
 }
 
-func GetFileDeletionInfo(app *app.Application, customUrl string) (*types.File, error) {
-	query := `SELECT id, custom_url, vizualizations, deletes_after_download, downloads_for_deletion, 
-		deletes_after_vizualizations, vizualizations_for_deletion, deleted_at, downloads
-		FROM file WHERE custom_url = $1`
-
-	rows, err := app.DB.Query(query, customUrl)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	if rows.Next() {
-		var file types.File
-		err := rows.Scan(
-			&file.Id,
-			&file.CustomUrl,
-			&file.Vizualizations,
-			&file.DeletesAfterDownload,
-			&file.DownloadsForDeletion,
-			&file.DeletesAfterVizualizations,
-			&file.VizualizationsForDeletion,
-			&file.DeletedAt,
-			&file.Downloads,
-		)
-		if err != nil {
-			return nil, err
-		}
-		return &file, nil
-	}
-
-	return nil, nil
-}
-
 func UpdateExpirationSettings(app *app.Application, customUrl string, expiresIn *time.Time) error {
 	query := `UPDATE file 
 		SET expires_in = $1
@@ -192,8 +478,17 @@ func UpdateExpirationSettings(app *app.Application, customUrl string, expiresIn
 	return err
 }
 
+func UpdateExpiresAfterView(app *app.Application, customUrl string, seconds *int) error {
+	query := `UPDATE file 
+		SET expires_after_view_seconds = $1
+		WHERE custom_url = $2`
+
+	_, err := app.DB.Exec(query, seconds, customUrl)
+	return err
+}
+
 func GetExpiredFiles(app *app.Application) ([]*types.File, error) {
-	query := `SELECT * FROM file 
+	query := `SELECT ` + fileColumns + ` FROM file 
 		WHERE expires_in IS NOT NULL 
 		AND expires_in <= CURRENT_TIMESTAMP 
 		AND deleted_at IS NULL`
@@ -206,38 +501,45 @@ func GetExpiredFiles(app *app.Application) ([]*types.File, error) {
 
 	var files []*types.File
 	for rows.Next() {
-		var file types.File
-		err := rows.Scan(
-			&file.Id,
-			&file.CustomUrl,
-			&file.Path,
-			&file.OriginalName,
-			&file.Size,
-			&file.Type,
-			&file.CreatedAt,
-			&file.Status,
-			&file.Vizualizations,
-			&file.DeletesAfterDownload,
-			&file.DeletedAt,
-			&file.DownloadsForDeletion,
-			&file.DeletesAfterVizualizations,
-			&file.VizualizationsForDeletion,
-			&file.LastVizualization,
-			&file.ExpiresIn,
-		)
+		file, err := scanFile(rows)
 		if err != nil {
 			return nil, err
 		}
-		files = append(files, &file)
+		files = append(files, file)
 	}
 
 	return files, nil
 }
 
-func IncrementDownloads(app *app.Application, customUrl string) error {
-	query := `UPDATE file 
-		SET downloads = downloads + 1
-		WHERE custom_url = $1`
+// GetUnremovedDeletedFiles returns deleted files whose storage was due to be
+// removed by now but has not been, such as the last view of a burned file
+// when the server restarted before its URL expired.
+func GetUnremovedDeletedFiles(app *app.Application) ([]*types.File, error) {
+	query := `SELECT ` + fileColumns + ` FROM file 
+		WHERE deleted_at IS NOT NULL
+		AND storage_deleted_at IS NULL
+		AND expires_in <= CURRENT_TIMESTAMP`
+
+	rows, err := app.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*types.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func MarkStorageDeleted(app *app.Application, customUrl string) error {
+	query := `UPDATE file SET storage_deleted_at = CURRENT_TIMESTAMP WHERE custom_url = $1`
 
 	_, err := app.DB.Exec(query, customUrl)
 	return err
@@ -265,4 +567,4 @@ func GetFilePassword(app *app.Application, customUrl string) (*string, error) {
 		return nil, err
 	}
 	return hashedPassword, nil
-}
\ No newline at end of file
+}
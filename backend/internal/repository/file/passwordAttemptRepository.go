@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/types"
+	"time"
+)
+
+// ReservePasswordAttempt lets allow decide from the failure stats whether ip
+// may attempt the file's password and, if so, records the attempt as a
+// failure before the password is compared. Attempts on the same file or from
+// the same IP are serialized by advisory locks, so concurrent guesses count
+// against each other. The id of the recorded attempt is 0 when not allowed.
+func ReservePasswordAttempt(app *app.Application, fileId int, ip string, userAgent string, now time.Time, since time.Time, allow func(stats *types.PasswordFailureStats) bool) (int, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Always the file first, then the IP, so two attempts never wait on each
+	// other's lock
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('password_attempt:file:' || $1::TEXT))`, fileId)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('password_attempt:ip:' || $1::TEXT))`, ip)
+	if err != nil {
+		return 0, err
+	}
+
+	stats, err := getPasswordFailureStats(tx, fileId, ip, since)
+	if err != nil {
+		return 0, err
+	}
+	if !allow(stats) {
+		return 0, nil
+	}
+
+	var id int
+	err = tx.QueryRow(`INSERT INTO password_attempt (file_id, ip, user_agent, created_at) VALUES ($1, $2, $3, $4) RETURNING id`,
+		fileId, ip, userAgent, now).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// DeletePasswordAttempt forgets a reserved attempt that turned out to have the
+// right password.
+func DeletePasswordAttempt(app *app.Application, id int) error {
+	_, err := app.DB.Exec(`DELETE FROM password_attempt WHERE id = $1`, id)
+	return err
+}
+
+func getPasswordFailureStats(db querier, fileId int, ip string, since time.Time) (*types.PasswordFailureStats, error) {
+	query := `SELECT
+			COUNT(*) FILTER (WHERE file_id = $1),
+			MAX(created_at) FILTER (WHERE file_id = $1),
+			COUNT(*) FILTER (WHERE ip = $2),
+			MAX(created_at) FILTER (WHERE ip = $2),
+			COUNT(*) FILTER (WHERE file_id = $1 AND ip = $2),
+			MAX(created_at) FILTER (WHERE file_id = $1 AND ip = $2)
+		FROM password_attempt
+		WHERE (file_id = $1 OR ip = $2)
+		AND created_at >= $3
+		AND cleared_at IS NULL`
+
+	var stats types.PasswordFailureStats
+	err := db.QueryRow(query, fileId, ip, since).Scan(
+		&stats.FileFailures,
+		&stats.LastFileFailure,
+		&stats.IPFailures,
+		&stats.LastIPFailure,
+		&stats.PairFailures,
+		&stats.LastPairFailure,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+func ListPasswordAttempts(app *app.Application, fileId int, limit int) ([]*types.PasswordAttempt, error) {
+	query := `SELECT id, file_id, ip, user_agent, created_at, cleared_at
+		FROM password_attempt WHERE file_id = $1
+		ORDER BY created_at DESC LIMIT $2`
+
+	rows, err := app.DB.Query(query, fileId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []*types.PasswordAttempt{}
+	for rows.Next() {
+		var attempt types.PasswordAttempt
+		err := rows.Scan(&attempt.Id, &attempt.FileId, &attempt.IP, &attempt.UserAgent, &attempt.CreatedAt, &attempt.ClearedAt)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, &attempt)
+	}
+	return attempts, rows.Err()
+}
+
+// ClearPasswordFailures stops the file's failures from counting, either all of
+// them or only those from ip when it is given.
+func ClearPasswordFailures(app *app.Application, fileId int, ip *string) error {
+	query := `UPDATE password_attempt SET cleared_at = CURRENT_TIMESTAMP
+		WHERE file_id = $1 AND cleared_at IS NULL AND ($2::TEXT IS NULL OR ip = $2)`
+
+	_, err := app.DB.Exec(query, fileId, ip)
+	return err
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"database/sql"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/types"
+	"time"
+)
+
+const shareLinkColumns = `id, file_id, label, password, max_views, views, expires_at, created_at, last_viewed_at, revoked_at`
+
+func scanShareLink(row scanner) (*types.ShareLink, error) {
+	var link types.ShareLink
+	err := row.Scan(
+		&link.Id,
+		&link.FileId,
+		&link.Label,
+		&link.Password,
+		&link.MaxViews,
+		&link.Views,
+		&link.ExpiresAt,
+		&link.CreatedAt,
+		&link.LastViewedAt,
+		&link.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func CreateShareLink(app *app.Application, link *types.ShareLink) error {
+	query := `INSERT INTO share_link (file_id, label, password, max_views, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	return app.DB.QueryRow(query, link.FileId, link.Label, link.Password, link.MaxViews, link.ExpiresAt, link.CreatedAt).Scan(&link.Id)
+}
+
+func FindShareLink(app *app.Application, id int) (*types.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_link WHERE id = $1`
+
+	link, err := scanShareLink(app.DB.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return link, err
+}
+
+func ListShareLinks(app *app.Application, fileId int) ([]*types.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_link WHERE file_id = $1 ORDER BY created_at DESC`
+
+	rows, err := app.DB.Query(query, fileId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []*types.ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// ConsumeShareLinkView counts a view on the link if it is still usable, in a
+// single statement so concurrent viewers cannot overrun max_views. It reports
+// whether the view was allowed.
+func ConsumeShareLinkView(app *app.Application, id int) (bool, error) {
+	return consumeShareLinkView(app.DB, id)
+}
+
+// ClaimSharedVizualization counts a view through the share link together
+// with a view of the file, as in ClaimVizualization. Neither is counted
+// unless both can be: linkActive is false when the link can no longer be
+// used, and claimed when the file has no views left.
+func ClaimSharedVizualization(app *app.Application, customUrl string, linkId int, viewerHash string, window time.Duration) (linkActive bool, claimed bool, last bool, err error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return false, false, false, err
+	}
+	defer tx.Rollback()
+
+	linkActive, err = consumeShareLinkView(tx, linkId)
+	if err != nil || !linkActive {
+		return false, false, false, err
+	}
+	claimed, last, err = claimVizualization(tx, customUrl, viewerHash, window)
+	if err != nil || !claimed {
+		return true, false, false, err
+	}
+	return true, true, last, tx.Commit()
+}
+
+func consumeShareLinkView(db querier, id int) (bool, error) {
+	query := `UPDATE share_link
+		SET views = views + 1,
+			last_viewed_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		AND (max_views IS NULL OR views < max_views)
+		RETURNING true`
+
+	var allowed bool
+	err := db.QueryRow(query, id).Scan(&allowed)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return allowed, err
+}
+
+func RevokeShareLink(app *app.Application, fileId int, id int) (bool, error) {
+	query := `UPDATE share_link SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND file_id = $2 AND revoked_at IS NULL`
+
+	result, err := app.DB.Exec(query, id, fileId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/types"
+	"time"
+)
+
+// TrashFile moves a file to the trash, reporting false when it is already
+// trashed or deleted.
+func TrashFile(app *app.Application, customUrl string) (bool, error) {
+	query := `UPDATE file 
+		SET trashed_at = CURRENT_TIMESTAMP
+		WHERE custom_url = $1 AND trashed_at IS NULL AND deleted_at IS NULL`
+
+	result, err := app.DB.Exec(query, customUrl)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// RestoreFile takes a file out of the trash if it was trashed after since,
+// reporting false when there is no such file.
+func RestoreFile(app *app.Application, customUrl string, since time.Time) (bool, error) {
+	query := `UPDATE file 
+		SET trashed_at = NULL
+		WHERE custom_url = $1 AND trashed_at > $2 AND deleted_at IS NULL`
+
+	result, err := app.DB.Exec(query, customUrl, since)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// GetTrashedFiles returns files trashed before the given time that have not
+// been purged yet.
+func GetTrashedFiles(app *app.Application, before time.Time) ([]*types.File, error) {
+	query := `SELECT ` + fileColumns + ` FROM file 
+		WHERE trashed_at < $1 AND deleted_at IS NULL`
+
+	rows, err := app.DB.Query(query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*types.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// ScrubFile marks a purged file as deleted and clears what gave access to it.
+func ScrubFile(app *app.Application, customUrl string) error {
+	query := `UPDATE file 
+		SET deleted_at = CURRENT_TIMESTAMP,
+			status = $1,
+			path = NULL,
+			password = NULL,
+			management_token_hash = NULL
+		WHERE custom_url = $2`
+
+	_, err := app.DB.Exec(query, types.Deleted, customUrl)
+	return err
+}
+
+// GetFilesToPurge returns files deleted before the given time whose metadata
+// has not been anonymized yet.
+func GetFilesToPurge(app *app.Application, before time.Time) ([]*types.File, error) {
+	query := `SELECT ` + fileColumns + ` FROM file 
+		WHERE deleted_at < $1 AND purged_at IS NULL`
+
+	rows, err := app.DB.Query(query, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*types.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// PurgeFile anonymizes a deleted file's row, dropping its password attempts,
+// share links, analytics events and seen viewers. With releaseUrl the customUrl is replaced by a
+// placeholder, which no upload can pick as it contains a slash, so the
+// customUrl can be taken by a new upload.
+func PurgeFile(app *app.Application, id int, releaseUrl bool) error {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE file 
+		SET original_name = '',
+			size = 0,
+			type = '',
+			path = NULL,
+			password = NULL,
+			owner_id = NULL,
+			uploader = NULL,
+			management_token_hash = NULL,
+			custom_url = CASE WHEN $2 THEN 'purged/' || id ELSE custom_url END,
+			status = $3,
+			purged_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	if _, err = tx.Exec(query, id, releaseUrl, types.Deleted); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM password_attempt WHERE file_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM share_link WHERE file_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM file_event WHERE file_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM file_viewer WHERE file_id = $1`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
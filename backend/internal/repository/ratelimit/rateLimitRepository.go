@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"gabrielsy/imgnow/internal/app"
+	"time"
+)
+
+// TakeToken locks the bucket row for key, creating it full when missing, and
+// lets take compute the new token count from the stored one. The result of
+// take is persisted in the same transaction, so concurrent servers sharing the
+// database see a consistent bucket.
+func TakeToken(app *app.Application, key string, burst int, now time.Time, take func(tokens float64, updatedAt time.Time) (float64, bool)) (bool, float64, error) {
+	tx, err := app.DB.Begin()
+	if err != nil {
+		return false, 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO rate_limit_bucket (key, tokens, updated_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING`, key, burst, now)
+	if err != nil {
+		return false, 0, err
+	}
+
+	var tokens float64
+	var updatedAt time.Time
+	err = tx.QueryRow(`SELECT tokens, updated_at FROM rate_limit_bucket WHERE key = $1 FOR UPDATE`, key).Scan(&tokens, &updatedAt)
+	if err != nil {
+		return false, 0, err
+	}
+
+	tokens, allowed := take(tokens, updatedAt)
+
+	_, err = tx.Exec(`UPDATE rate_limit_bucket SET tokens = $1, updated_at = $2 WHERE key = $3`, tokens, now, key)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, 0, err
+	}
+	return allowed, tokens, nil
+}
+
+// DeleteIdleBuckets removes buckets untouched since before, which are full
+// again by then and carry no state worth keeping.
+func DeleteIdleBuckets(app *app.Application, before time.Time) error {
+	_, err := app.DB.Exec(`DELETE FROM rate_limit_bucket WHERE updated_at < $1`, before)
+	return err
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"database/sql"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/types"
+	"strings"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (*types.APIKey, error) {
+	var key types.APIKey
+	var scopes string
+	err := row.Scan(
+		&key.Id,
+		&key.UserId,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&scopes,
+		&key.CreatedAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope != "" {
+			key.Scopes = append(key.Scopes, types.APIKeyScope(scope))
+		}
+	}
+	return &key, nil
+}
+
+func CreateAPIKey(app *app.Application, key *types.APIKey) error {
+	query := `INSERT INTO api_key (user_id, name, prefix, key_hash, scopes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+
+	return app.DB.QueryRow(query, key.UserId, key.Name, key.Prefix, key.KeyHash, strings.Join(scopes, ","), key.CreatedAt).Scan(&key.Id)
+}
+
+func ListAPIKeys(app *app.Application, userId int) ([]*types.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_key WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := app.DB.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*types.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// FindActiveAPIKey returns the unrevoked key with the given hash, or nil.
+func FindActiveAPIKey(app *app.Application, keyHash string) (*types.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_key WHERE key_hash = $1 AND revoked_at IS NULL`
+
+	key, err := scanAPIKey(app.DB.QueryRow(query, keyHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+func TouchAPIKey(app *app.Application, id int) error {
+	query := `UPDATE api_key SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1`
+
+	_, err := app.DB.Exec(query, id)
+	return err
+}
+
+// RevokeAPIKey revokes one of the user's keys and reports whether it existed.
+func RevokeAPIKey(app *app.Application, userId int, id int) (bool, error) {
+	query := `UPDATE api_key SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	result, err := app.DB.Exec(query, id, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
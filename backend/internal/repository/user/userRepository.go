@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"database/sql"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/types"
+	"time"
+)
+
+func CreateUser(app *app.Application, user *types.User) error {
+	query := `INSERT INTO users (email, password, created_at) VALUES ($1, $2, $3) RETURNING id`
+
+	return app.DB.QueryRow(query, user.Email, user.Password, user.CreatedAt).Scan(&user.Id)
+}
+
+func FindUserByEmail(app *app.Application, email string) (*types.User, error) {
+	query := `SELECT id, email, password, created_at FROM users WHERE email = $1`
+
+	var user types.User
+	err := app.DB.QueryRow(query, email).Scan(&user.Id, &user.Email, &user.Password, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func FindUserById(app *app.Application, id int) (*types.User, error) {
+	query := `SELECT id, email, password, created_at FROM users WHERE id = $1`
+
+	var user types.User
+	err := app.DB.QueryRow(query, id).Scan(&user.Id, &user.Email, &user.Password, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func CreateSession(app *app.Application, session *types.Session) error {
+	query := `INSERT INTO session (token_hash, user_id, created_at, expires_at) VALUES ($1, $2, $3, $4)`
+
+	_, err := app.DB.Exec(query, session.TokenHash, session.UserId, session.CreatedAt, session.ExpiresAt)
+	return err
+}
+
+// FindUserBySession returns the user owning an unexpired session, or nil.
+func FindUserBySession(app *app.Application, tokenHash string) (*types.User, error) {
+	query := `SELECT u.id, u.email, u.password, u.created_at
+		FROM session s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > $2`
+
+	var user types.User
+	err := app.DB.QueryRow(query, tokenHash, time.Now()).Scan(&user.Id, &user.Email, &user.Password, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func DeleteSession(app *app.Application, tokenHash string) error {
+	query := `DELETE FROM session WHERE token_hash = $1`
+
+	_, err := app.DB.Exec(query, tokenHash)
+	return err
+}
+
+func DeleteExpiredSessions(app *app.Application) error {
+	query := `DELETE FROM session WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	_, err := app.DB.Exec(query)
+	return err
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"database/sql"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/types"
+	"strings"
+	"time"
+)
+
+const webhookColumns = `id, user_id, url, secret, events, active, created_at`
+
+func scanWebhook(row interface{ Scan(dest ...any) error }) (*types.Webhook, error) {
+	var webhook types.Webhook
+	var events string
+	err := row.Scan(
+		&webhook.Id,
+		&webhook.UserId,
+		&webhook.Url,
+		&webhook.Secret,
+		&events,
+		&webhook.Active,
+		&webhook.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range strings.Split(events, ",") {
+		if event != "" {
+			webhook.Events = append(webhook.Events, types.WebhookEvent(event))
+		}
+	}
+	return &webhook, nil
+}
+
+func joinEvents(events []types.WebhookEvent) string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = string(event)
+	}
+	return strings.Join(names, ",")
+}
+
+func CreateWebhook(app *app.Application, webhook *types.Webhook) error {
+	query := `INSERT INTO webhook (user_id, url, secret, events, active, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	return app.DB.QueryRow(query, webhook.UserId, webhook.Url, webhook.Secret, joinEvents(webhook.Events), webhook.Active, webhook.CreatedAt).Scan(&webhook.Id)
+}
+
+func ListWebhooks(app *app.Application, userId int) ([]*types.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook WHERE user_id = $1 ORDER BY created_at DESC`
+
+	rows, err := app.DB.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*types.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// FindWebhook returns the user's webhook with the given id, or nil.
+func FindWebhook(app *app.Application, userId int, id int) (*types.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook WHERE id = $1 AND user_id = $2`
+
+	webhook, err := scanWebhook(app.DB.QueryRow(query, id, userId))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return webhook, err
+}
+
+func FindWebhookById(app *app.Application, id int) (*types.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhook WHERE id = $1`
+
+	webhook, err := scanWebhook(app.DB.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return webhook, err
+}
+
+func UpdateWebhook(app *app.Application, webhook *types.Webhook) error {
+	query := `UPDATE webhook SET url = $1, secret = $2, events = $3, active = $4 WHERE id = $5`
+
+	_, err := app.DB.Exec(query, webhook.Url, webhook.Secret, joinEvents(webhook.Events), webhook.Active, webhook.Id)
+	return err
+}
+
+// DeleteWebhook deletes one of the user's webhooks with its deliveries and
+// reports whether it existed.
+func DeleteWebhook(app *app.Application, userId int, id int) (bool, error) {
+	query := `DELETE FROM webhook WHERE id = $1 AND user_id = $2`
+
+	result, err := app.DB.Exec(query, id, userId)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+const webhookDeliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at,
+	response_status, response_body, error, created_at, delivered_at`
+
+func scanWebhookDelivery(row interface{ Scan(dest ...any) error }) (*types.WebhookDelivery, error) {
+	var delivery types.WebhookDelivery
+	err := row.Scan(
+		&delivery.Id,
+		&delivery.WebhookId,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.ResponseStatus,
+		&delivery.ResponseBody,
+		&delivery.Error,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func CreateWebhookDelivery(app *app.Application, delivery *types.WebhookDelivery) error {
+	query := `INSERT INTO webhook_delivery (webhook_id, event, payload, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+
+	return app.DB.QueryRow(query, delivery.WebhookId, delivery.Event, delivery.Payload, delivery.Status, delivery.NextAttemptAt, delivery.CreatedAt).Scan(&delivery.Id)
+}
+
+// ClaimDueWebhookDeliveries takes up to limit pending deliveries whose next
+// attempt is due, pushing their next attempt to leaseUntil so concurrent
+// workers skip them while they are being sent.
+func ClaimDueWebhookDeliveries(app *app.Application, limit int, leaseUntil time.Time) ([]*types.WebhookDelivery, error) {
+	query := `UPDATE webhook_delivery SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_delivery
+			WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + webhookDeliveryColumns
+
+	rows, err := app.DB.Query(query, leaseUntil, types.DeliveryPending, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*types.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// UpdateWebhookDelivery stores the outcome of an attempt.
+func UpdateWebhookDelivery(app *app.Application, delivery *types.WebhookDelivery) error {
+	query := `UPDATE webhook_delivery
+		SET status = $1, attempts = $2, next_attempt_at = $3, response_status = $4,
+			response_body = $5, error = $6, delivered_at = $7
+		WHERE id = $8`
+
+	_, err := app.DB.Exec(query, delivery.Status, delivery.Attempts, delivery.NextAttemptAt, delivery.ResponseStatus,
+		delivery.ResponseBody, delivery.Error, delivery.DeliveredAt, delivery.Id)
+	return err
+}
+
+// ListWebhookDeliveries returns the webhook's latest deliveries, newest first.
+func ListWebhookDeliveries(app *app.Application, webhookId int, limit int) ([]*types.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_delivery
+		WHERE webhook_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2`
+
+	rows, err := app.DB.Query(query, webhookId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*types.WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+func DeleteWebhookDeliveriesBefore(app *app.Application, before time.Time) error {
+	query := `DELETE FROM webhook_delivery WHERE created_at < $1 AND status <> $2`
+
+	_, err := app.DB.Exec(query, before, types.DeliveryPending)
+	return err
+}
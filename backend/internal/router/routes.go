@@ -1,34 +1,174 @@
 package router
 
 import (
+	"gabrielsy/imgnow/internal/apierror"
 	"gabrielsy/imgnow/internal/app"
+	docsController "gabrielsy/imgnow/internal/controller/docs"
 	controller "gabrielsy/imgnow/internal/controller/file"
+	integrationController "gabrielsy/imgnow/internal/controller/integration"
+	pageController "gabrielsy/imgnow/internal/controller/page"
+	userController "gabrielsy/imgnow/internal/controller/user"
+	webhookController "gabrielsy/imgnow/internal/controller/webhook"
+	"gabrielsy/imgnow/internal/middleware"
+	service "gabrielsy/imgnow/internal/service"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"net/http"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func SetupRoutes(app *app.Application) *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	r.HandleMethodNotAllowed = true
+
+	// Client IPs drive rate limits, quotas and password lockouts, so
+	// X-Forwarded-For is only believed from proxies listed in TRUSTED_PROXIES
+	if err := r.SetTrustedProxies(trustedProxies(app)); err != nil {
+		util.LogError(err, "Invalid TRUSTED_PROXIES, trusting no proxies", app)
+		r.SetTrustedProxies(nil)
+	}
+	r.Use(gin.Logger(), gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		apierror.Abort(c, http.StatusInternalServerError, "Internal server error")
+	}))
+	r.Use(middleware.RequestID())
 
 	// Configure CORS
 	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:4200"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowOrigins: []string{"http://localhost:4200"},
+		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Access-Token", "X-Management-Token", "X-Request-ID"},
+		ExposeHeaders: []string{
+			"Content-Length", "Content-Range", "Content-Disposition", "ETag", "Last-Modified", "Retry-After",
+			"X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset",
+			"X-Quota-Bytes-Limit", "X-Quota-Bytes-Used", "X-Quota-Files-Limit", "X-Quota-Files-Used",
+			"X-Request-ID", "Deprecation", "Link",
+		},
 		AllowCredentials: true,
 	}))
 
-	fileController := controller.NewFileController(app)
-	r.POST("/api/file/upload", fileController.UploadFile)
-	r.POST("/api/file/:customUrl", fileController.GetFileByCustomUrl)
-	r.GET("/api/file/:customUrl", fileController.GetFileByCustomUrl)
-	r.GET("/api/file/:customUrl/status", fileController.GetFileStatus)
-	r.GET("/api/file/:customUrl/info", fileController.GetFileInfo)
+	r.Use(middleware.Authenticate(app))
+
+	r.NoRoute(func(c *gin.Context) {
+		apierror.Abort(c, http.StatusNotFound, "Not found")
+	})
+	r.NoMethod(func(c *gin.Context) {
+		apierror.Abort(c, http.StatusMethodNotAllowed, "Method not allowed")
+	})
+
+	api := newAPI(app)
+	api.register(r.Group(util.APIPrefix))
+	// The unversioned API predates /api/v1 and stays as an alias of it for
+	// existing clients
+	api.register(r.Group("/api", middleware.DeprecatedAlias("/api", util.APIPrefix)))
+
+	dc := docsController.NewDocsController(app)
+	r.GET("/api/openapi.json", dc.OpenAPI)
+
+	r.GET("/i/:customUrl", api.files.ServeRawFile)
+	r.GET("/i/:customUrl/thumbnail", api.files.ServeThumbnail)
 
-	r.PUT("/api/file/:customUrl/settings", fileController.UpdateFileSettings)
-	r.PUT("/api/file/:customUrl/addDownload", fileController.AddDownload)
+	// Link previews for pasted file URLs, registered last as it matches any
+	// top-level path
+	r.GET("/:customUrl", api.pages.FilePage)
 
 	return r
 }
+
+// trustedProxies reads the comma separated IPs and CIDRs of TRUSTED_PROXIES.
+// None are trusted by default.
+func trustedProxies(app *app.Application) []string {
+	var proxies []string
+	for _, proxy := range strings.Split(util.GetEnv("TRUSTED_PROXIES", app), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// api holds the handlers of the API, shared by every prefix it is served
+// under so rate limits apply across them.
+type api struct {
+	app           *app.Application
+	files         *controller.FileController
+	users         *userController.UserController
+	integrations  *integrationController.IntegrationController
+	pages         *pageController.PageController
+	webhooks      *webhookController.WebhookController
+	uploadLimit   gin.HandlerFunc
+	passwordLimit gin.HandlerFunc
+	authLimit     gin.HandlerFunc
+}
+
+func newAPI(app *app.Application) *api {
+	rateLimitStore := service.NewRateLimitStore(app)
+	return &api{
+		app:           app,
+		files:         controller.NewFileController(app),
+		users:         userController.NewUserController(app),
+		integrations:  integrationController.NewIntegrationController(app),
+		pages:         pageController.NewPageController(app),
+		webhooks:      webhookController.NewWebhookController(app),
+		uploadLimit:   middleware.RateLimit(app, rateLimitStore, service.UploadRateLimit(app), nil),
+		passwordLimit: middleware.RateLimit(app, rateLimitStore, service.PasswordRateLimit(app), middleware.HasBody),
+		authLimit:     middleware.RateLimit(app, rateLimitStore, service.AuthRateLimit(app), nil),
+	}
+}
+
+func (a *api) register(r *gin.RouterGroup) {
+	fileController := a.files
+	r.POST("/file/upload", middleware.RequireScope(types.ScopeUpload), a.uploadLimit, middleware.UploadQuota(a.app), fileController.UploadFile)
+	r.POST("/file/:customUrl", a.passwordLimit, fileController.GetFileByCustomUrl)
+	r.GET("/file/:customUrl", a.passwordLimit, fileController.GetFileByCustomUrl)
+	r.GET("/share/:token", a.passwordLimit, fileController.GetFileByShareLink)
+	r.POST("/share/:token", a.passwordLimit, fileController.GetFileByShareLink)
+	r.GET("/file/:customUrl/download", a.passwordLimit, fileController.DownloadFile)
+	r.POST("/file/:customUrl/download", a.passwordLimit, fileController.DownloadFile)
+	r.GET("/file/:customUrl/status", fileController.GetFileStatus)
+	r.GET("/file/:customUrl/info", fileController.GetFileInfo)
+	r.GET("/file/:customUrl/waveform", fileController.GetFileWaveform)
+	r.GET("/file/:customUrl/stats", middleware.RequireScope(types.ScopeRead), fileController.GetFileStats)
+
+	r.PUT("/file/:customUrl/settings", middleware.RequireScope(types.ScopeManage), fileController.UpdateFileSettings)
+	r.DELETE("/file/:customUrl", middleware.RequireScope(types.ScopeManage), fileController.DeleteFile)
+	r.POST("/file/:customUrl/restore", middleware.RequireScope(types.ScopeManage), fileController.RestoreFile)
+
+	uc := a.users
+	r.POST("/auth/register", a.authLimit, uc.Register)
+	r.POST("/auth/login", a.authLimit, uc.Login)
+	r.POST("/auth/logout", uc.Logout)
+
+	me := r.Group("/me", middleware.RequireUser())
+	me.GET("", uc.Me)
+	me.GET("/files", middleware.RequireScope(types.ScopeRead), uc.ListFiles)
+	me.PUT("/files/settings", middleware.RequireScope(types.ScopeManage), uc.BulkUpdateSettings)
+	me.DELETE("/files", middleware.RequireScope(types.ScopeManage), uc.BulkDelete)
+	me.GET("/files/:customUrl/password-attempts", middleware.RequireScope(types.ScopeRead), uc.ListPasswordAttempts)
+	me.POST("/files/:customUrl/unlock", middleware.RequireScope(types.ScopeManage), uc.UnlockFile)
+	me.GET("/files/:customUrl/shares", middleware.RequireScope(types.ScopeRead), uc.ListShareLinks)
+	me.POST("/files/:customUrl/shares", middleware.RequireScope(types.ScopeManage), uc.CreateShareLink)
+	me.DELETE("/files/:customUrl/shares/:id", middleware.RequireScope(types.ScopeManage), uc.RevokeShareLink)
+
+	wc := a.webhooks
+	me.GET("/webhooks", middleware.RequireScope(types.ScopeRead), wc.ListWebhooks)
+	me.POST("/webhooks", middleware.RequireScope(types.ScopeManage), wc.CreateWebhook)
+	me.PATCH("/webhooks/:id", middleware.RequireScope(types.ScopeManage), wc.UpdateWebhook)
+	me.DELETE("/webhooks/:id", middleware.RequireScope(types.ScopeManage), wc.DeleteWebhook)
+	me.GET("/webhooks/:id/deliveries", middleware.RequireScope(types.ScopeRead), wc.ListDeliveries)
+	me.POST("/webhooks/:id/test", middleware.RequireScope(types.ScopeManage), wc.TestWebhook)
+
+	keys := me.Group("/keys", middleware.RequireSession())
+	keys.POST("", uc.CreateAPIKey)
+	keys.GET("", uc.ListAPIKeys)
+	keys.DELETE("/:id", uc.RevokeAPIKey)
+
+	r.POST("/integrations/sharex.sxcu", middleware.RequireSession(), a.integrations.ShareXConfig)
+
+	pc := a.pages
+	r.GET("/oembed", pc.OEmbed)
+	r.GET("/file/:customUrl/delete", pc.DeletePage)
+	r.POST("/file/:customUrl/delete", pc.ConfirmDelete)
+}
@@ -0,0 +1,152 @@
+package router
+
+import (
+	"encoding/json"
+	"gabrielsy/imgnow/internal/apierror"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/util"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pathParam matches gin's :param path segments.
+var pathParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+func newTestRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	return SetupRoutes(&app.Application{Logger: log.New(io.Discard, "", 0)})
+}
+
+// specOperations lists the operations of the embedded OpenAPI document as
+// "METHOD /path", with paths relative to its /api/v1 server.
+func specOperations(t *testing.T) map[string]bool {
+	t.Helper()
+	data, err := os.ReadFile("../controller/docs/openapi.json")
+	if err != nil {
+		t.Fatalf("read openapi.json: %v", err)
+	}
+
+	var spec struct {
+		Servers []struct {
+			Url string `json:"url"`
+		} `json:"servers"`
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatalf("parse openapi.json: %v", err)
+	}
+	if len(spec.Servers) != 1 || spec.Servers[0].Url != util.APIPrefix {
+		t.Fatalf("openapi.json servers = %+v, want a single %s server", spec.Servers, util.APIPrefix)
+	}
+
+	operations := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "options", "head", "patch", "trace":
+				operations[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+	return operations
+}
+
+// routeOperations lists the routes registered under /api/v1 in the same form
+// as specOperations.
+func routeOperations(r *gin.Engine) map[string]bool {
+	operations := map[string]bool{}
+	for _, route := range r.Routes() {
+		path, ok := strings.CutPrefix(route.Path, util.APIPrefix)
+		if !ok {
+			continue
+		}
+		if path == "" {
+			path = "/"
+		}
+		path = pathParam.ReplaceAllString(path, "{$1}")
+		operations[route.Method+" "+path] = true
+	}
+	return operations
+}
+
+func missing(from map[string]bool, in map[string]bool) []string {
+	var operations []string
+	for operation := range from {
+		if !in[operation] {
+			operations = append(operations, operation)
+		}
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	routes := routeOperations(newTestRouter(t))
+	spec := specOperations(t)
+
+	for _, operation := range missing(routes, spec) {
+		t.Errorf("route %s is not documented in openapi.json", operation)
+	}
+	for _, operation := range missing(spec, routes) {
+		t.Errorf("openapi.json documents %s, which is not routed", operation)
+	}
+}
+
+func TestUnmatchedRequestsUseErrorEnvelope(t *testing.T) {
+	r := newTestRouter(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		code   apierror.Code
+	}{
+		{"unknown path", http.MethodGet, util.APIPrefix + "/no/such/route", http.StatusNotFound, apierror.NotFound},
+		{"wrong method", http.MethodDelete, util.APIPrefix + "/auth/login", http.StatusMethodNotAllowed, apierror.MethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.status)
+			}
+
+			var body map[string]json.RawMessage
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("parse body %q: %v", recorder.Body.String(), err)
+			}
+			if len(body) != 1 || body["error"] == nil {
+				t.Fatalf("body = %s, want only an error object", recorder.Body.String())
+			}
+
+			var envelope apierror.Error
+			if err := json.Unmarshal(body["error"], &envelope); err != nil {
+				t.Fatalf("parse error %s: %v", body["error"], err)
+			}
+			if envelope.Code != tt.code {
+				t.Errorf("code = %q, want %q", envelope.Code, tt.code)
+			}
+			if envelope.Message == "" {
+				t.Error("message is empty")
+			}
+			requestID := recorder.Header().Get(apierror.RequestIDHeader)
+			if requestID == "" || envelope.RequestID != requestID {
+				t.Errorf("requestId = %q, want the %s header %q", envelope.RequestID, apierror.RequestIDHeader, requestID)
+			}
+		})
+	}
+}
@@ -1,15 +1,30 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"gabrielsy/imgnow/internal/app"
 	"gabrielsy/imgnow/internal/util"
 	"io"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// S3 rejects non-final parts smaller than 5 MiB
+	minPartSize              = 5 << 20
+	defaultPartSize          = 8 << 20
+	defaultUploadConcurrency = 4
+	maxParts                 = 10000
 )
 
 type R2Service struct {
@@ -60,6 +75,331 @@ func (rs *R2Service) UploadToR2(body io.Reader, contentType string, contentLengt
 	return err
 }
 
+// partBuffers recycles the part buffers of multipart uploads across uploads.
+var partBuffers sync.Pool
+
+func getPartBuffer(size int64) []byte {
+	if buf, ok := partBuffers.Get().(*[]byte); ok && int64(cap(*buf)) >= size {
+		return (*buf)[:size]
+	}
+	return make([]byte, size)
+}
+
+func putPartBuffer(buf []byte) {
+	partBuffers.Put(&buf)
+}
+
+// PartSize is the size of the parts of multipart uploads, from R2_PART_SIZE.
+func (rs *R2Service) PartSize() int64 {
+	return max(util.GetEnvInt("R2_PART_SIZE", defaultPartSize, rs.app), minPartSize)
+}
+
+// UploadStreamToR2 uploads a body of unknown length. Bodies that fit in a
+// single part are buffered at their own size and sent with one PutObject,
+// larger ones use a multipart upload so only a few pooled parts are held in
+// memory at a time. It returns the bytes written.
+func (rs *R2Service) UploadStreamToR2(body io.Reader, contentType string, customUrl string) (int64, error) {
+	partSize := rs.PartSize()
+
+	var first bytes.Buffer
+	n, err := first.ReadFrom(io.LimitReader(body, partSize))
+	if err != nil {
+		return 0, err
+	}
+	if n < partSize {
+		return n, rs.UploadToR2(bytes.NewReader(first.Bytes()), contentType, n, customUrl)
+	}
+
+	// A body of exactly one part still fits a single PutObject
+	var next [1]byte
+	m, err := io.ReadFull(body, next[:])
+	if err == io.EOF {
+		return n, rs.UploadToR2(bytes.NewReader(first.Bytes()), contentType, n, customUrl)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return rs.uploadMultipart(io.MultiReader(&first, bytes.NewReader(next[:m]), body), contentType, customUrl, partSize)
+}
+
+// uploadMultipart reads the body in partSize chunks and uploads up to
+// R2_UPLOAD_CONCURRENCY parts at once. Any failure cancels the parts in flight
+// and aborts the upload so no orphaned parts are left behind.
+func (rs *R2Service) uploadMultipart(body io.Reader, contentType string, customUrl string, partSize int64) (int64, error) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	bucket := aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app))
+	upload, err := rs.s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      bucket,
+		Key:         aws.String(customUrl),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+
+	concurrency := int(util.GetEnvInt("R2_UPLOAD_CONCURRENCY", defaultUploadConcurrency, rs.app))
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		parts    []types.CompletedPart
+		firstErr error
+		total    int64
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+
+	// Each slot lets one part buffer be in use, which bounds memory to
+	// concurrency * partSize
+	slots := make(chan struct{}, concurrency)
+
+	for partNumber := int32(1); ctx.Err() == nil; partNumber++ {
+		if partNumber > maxParts {
+			fail(fmt.Errorf("object exceeds %d parts of %d bytes", maxParts, partSize))
+			break
+		}
+
+		slots <- struct{}{}
+		buf := getPartBuffer(partSize)
+		n, readErr := io.ReadFull(body, buf)
+		if readErr == io.EOF {
+			putPartBuffer(buf)
+			<-slots
+			break
+		}
+		if readErr != nil && readErr != io.ErrUnexpectedEOF {
+			putPartBuffer(buf)
+			<-slots
+			fail(readErr)
+			break
+		}
+		total += int64(n)
+
+		wg.Add(1)
+		go func(partNumber int32, buf []byte, n int) {
+			defer wg.Done()
+			defer func() {
+				putPartBuffer(buf)
+				<-slots
+			}()
+
+			part, err := rs.s3Client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:        bucket,
+				Key:           aws.String(customUrl),
+				UploadId:      upload.UploadId,
+				PartNumber:    aws.Int32(partNumber),
+				Body:          bytes.NewReader(buf[:n]),
+				ContentLength: aws.Int64(int64(n)),
+			})
+			if err != nil {
+				fail(fmt.Errorf("failed to upload part %d: %w", partNumber, err))
+				return
+			}
+
+			mu.Lock()
+			parts = append(parts, types.CompletedPart{ETag: part.ETag, PartNumber: aws.Int32(partNumber)})
+			mu.Unlock()
+		}(partNumber, buf, n)
+
+		if readErr == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		sort.Slice(parts, func(i, j int) bool {
+			return *parts[i].PartNumber < *parts[j].PartNumber
+		})
+		_, err = rs.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          bucket,
+			Key:             aws.String(customUrl),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+		if err == nil {
+			return total, nil
+		}
+		firstErr = fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	_, err = rs.s3Client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+		Bucket:   bucket,
+		Key:      aws.String(customUrl),
+		UploadId: upload.UploadId,
+	})
+	util.LogError(err, "Failed to abort multipart upload", rs.app)
+	return 0, firstErr
+}
+
+// UploadedPart is a part of a multipart upload sent through a presigned
+// URL, identified by the ETag R2 returned for it.
+type UploadedPart struct {
+	PartNumber int32
+	ETag       string
+}
+
+// StartMultipartUpload begins a multipart upload whose parts are sent by
+// someone without R2 credentials, through PresignUploadPart URLs.
+func (rs *R2Service) StartMultipartUpload(customUrl string, contentType string) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app)),
+		Key:    aws.String(customUrl),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	upload, err := rs.s3Client.CreateMultipartUpload(context.TODO(), input)
+	if err != nil {
+		return "", fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+	return *upload.UploadId, nil
+}
+
+// PresignUploadPart presigns a URL that uploads one part of the upload until
+// ttl has passed.
+func (rs *R2Service) PresignUploadPart(customUrl string, uploadId string, partNumber int32, ttl time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(rs.s3Client)
+	presignedUrl, err := presignClient.PresignUploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:     aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app)),
+		Key:        aws.String(customUrl),
+		UploadId:   aws.String(uploadId),
+		PartNumber: aws.Int32(partNumber),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return presignedUrl.URL, nil
+}
+
+func (rs *R2Service) CompleteMultipartUpload(customUrl string, uploadId string, parts []UploadedPart) error {
+	completed := make([]types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, types.CompletedPart{ETag: aws.String(part.ETag), PartNumber: aws.Int32(part.PartNumber)})
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return *completed[i].PartNumber < *completed[j].PartNumber
+	})
+
+	_, err := rs.s3Client.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app)),
+		Key:             aws.String(customUrl),
+		UploadId:        aws.String(uploadId),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+	return nil
+}
+
+func (rs *R2Service) AbortMultipartUpload(customUrl string, uploadId string) error {
+	_, err := rs.s3Client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app)),
+		Key:      aws.String(customUrl),
+		UploadId: aws.String(uploadId),
+	})
+	return err
+}
+
+// SetContentType replaces the content type of a stored object, copying it
+// onto itself within R2.
+func (rs *R2Service) SetContentType(customUrl string, contentType string) error {
+	bucket := util.GetEnv("R2_BUCKET_NAME", rs.app)
+	_, err := rs.s3Client.CopyObject(context.TODO(), &s3.CopyObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(customUrl),
+		CopySource:        aws.String(bucket + "/" + url.PathEscape(customUrl)),
+		ContentType:       aws.String(contentType),
+		MetadataDirective: types.MetadataDirectiveReplace,
+	})
+	return err
+}
+
+// CleanupMultipartUploads aborts multipart uploads started more than olderThan
+// ago. These are left behind when the process dies mid-upload and keep their
+// parts billed until aborted. It returns how many uploads were aborted.
+func (rs *R2Service) CleanupMultipartUploads(olderThan time.Duration) (int, error) {
+	bucket := aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app))
+	cutoff := time.Now().Add(-olderThan)
+	aborted := 0
+
+	input := &s3.ListMultipartUploadsInput{Bucket: bucket}
+	for {
+		page, err := rs.s3Client.ListMultipartUploads(context.TODO(), input)
+		if err != nil {
+			return aborted, fmt.Errorf("failed to list multipart uploads: %w", err)
+		}
+
+		for _, upload := range page.Uploads {
+			if upload.Initiated == nil || upload.Initiated.After(cutoff) {
+				continue
+			}
+			_, err := rs.s3Client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+				Bucket:   bucket,
+				Key:      upload.Key,
+				UploadId: upload.UploadId,
+			})
+			if err != nil {
+				util.LogError(err, "Failed to abort orphaned multipart upload", rs.app)
+				continue
+			}
+			aborted++
+		}
+
+		if page.IsTruncated == nil || !*page.IsTruncated {
+			return aborted, nil
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.UploadIdMarker = page.NextUploadIdMarker
+	}
+}
+
+// DeleteStaleObjects deletes the objects under prefix last modified more
+// than olderThan ago. It returns how many objects were deleted.
+func (rs *R2Service) DeleteStaleObjects(prefix string, olderThan time.Duration) (int, error) {
+	bucket := aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app))
+	cutoff := time.Now().Add(-olderThan)
+	deleted := 0
+
+	paginator := s3.NewListObjectsV2Paginator(rs.s3Client, &s3.ListObjectsV2Input{
+		Bucket: bucket,
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return deleted, fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		for _, object := range page.Contents {
+			if object.LastModified == nil || object.LastModified.After(cutoff) {
+				continue
+			}
+			if err := rs.DeleteFromR2(*object.Key); err != nil {
+				util.LogError(err, "Failed to delete stale object", rs.app)
+				continue
+			}
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
 func (rs *R2Service) GetFromR2(customUrl string) (string, error) {
 	presignClient := s3.NewPresignClient(rs.s3Client)
 	presignedUrl, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
@@ -73,6 +413,20 @@ func (rs *R2Service) GetFromR2(customUrl string) (string, error) {
 	return presignedUrl.URL, nil
 }
 
+// GetFromR2WithExpiry presigns a URL that stops working after ttl.
+func (rs *R2Service) GetFromR2WithExpiry(customUrl string, ttl time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(rs.s3Client)
+	presignedUrl, err := presignClient.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket: aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app)),
+		Key:    aws.String(customUrl),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return presignedUrl.URL, nil
+}
+
 func (rs *R2Service) GetFromR2Stream(customUrl string) (*s3.GetObjectOutput, error) {
 	return rs.s3Client.GetObject(context.TODO(), &s3.GetObjectInput{
 		Bucket: aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app)),
@@ -80,6 +434,43 @@ func (rs *R2Service) GetFromR2Stream(customUrl string) (*s3.GetObjectOutput, err
 	})
 }
 
+// R2ObjectRequest carries the range and validators of a client request
+// through to R2.
+type R2ObjectRequest struct {
+	Range           string
+	IfNoneMatch     string
+	IfModifiedSince *time.Time
+}
+
+// GetFromR2Object fetches the object honouring the request's range and
+// validators. When R2 answers with a bare status such as 304 or 416 instead
+// of the object, R2Status reports it from the returned error.
+func (rs *R2Service) GetFromR2Object(customUrl string, request R2ObjectRequest) (*s3.GetObjectOutput, error) {
+	input := &s3.GetObjectInput{
+		Bucket:          aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app)),
+		Key:             aws.String(customUrl),
+		IfModifiedSince: request.IfModifiedSince,
+	}
+	if request.Range != "" {
+		input.Range = aws.String(request.Range)
+	}
+	if request.IfNoneMatch != "" {
+		input.IfNoneMatch = aws.String(request.IfNoneMatch)
+	}
+
+	return rs.s3Client.GetObject(context.TODO(), input)
+}
+
+// R2Status returns the HTTP status of a failed R2 request, or 0 when the
+// request did not get a response.
+func R2Status(err error) int {
+	var responseErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &responseErr) {
+		return responseErr.HTTPStatusCode()
+	}
+	return 0
+}
+
 func (rs *R2Service) DeleteFromR2(customUrl string) error {
 	_, err := rs.s3Client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
 		Bucket: aws.String(util.GetEnv("R2_BUCKET_NAME", rs.app)),
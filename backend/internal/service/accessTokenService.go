@@ -0,0 +1,107 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"strings"
+	"time"
+)
+
+// AccessTokenPrefix tells file access tokens apart from API keys when they
+// arrive as bearer tokens. Session tokens are unprefixed random base64url and
+// can start the same way, so they are looked up before a prefixed token is
+// taken for an access token.
+const AccessTokenPrefix = "fa_"
+
+// accessTokenPurpose is signed into access tokens so no other signed token,
+// such as a share link's, passes for one.
+const accessTokenPurpose = "file_access"
+
+// minSigningSecretLength is the shortest SIGNING_SECRET accepted, as long as
+// the HMAC-SHA256 output.
+const minSigningSecretLength = 32
+
+// SigningSecret returns the HMAC key for signed tokens, from SIGNING_SECRET.
+// The server does not start without it, see CheckSigningSecret.
+func SigningSecret(app *app.Application) []byte {
+	return []byte(util.GetEnv("SIGNING_SECRET", app))
+}
+
+// CheckSigningSecret fails unless SIGNING_SECRET is set and long enough.
+// Signed tokens must survive restarts and be valid on every instance, so
+// there is no generated fallback.
+func CheckSigningSecret(app *app.Application) error {
+	if len(SigningSecret(app)) < minSigningSecretLength {
+		return fmt.Errorf("SIGNING_SECRET must be set to at least %d bytes", minSigningSecretLength)
+	}
+	return nil
+}
+
+type accessTokenPayload struct {
+	CustomUrl string `json:"u"`
+	// Ties the token to the current password so changing it revokes tokens
+	Password  string `json:"p"`
+	ExpiresAt int64  `json:"e"`
+}
+
+type AccessTokenService struct {
+	app *app.Application
+}
+
+func NewAccessTokenService(app *app.Application) *AccessTokenService {
+	return &AccessTokenService{app: app}
+}
+
+func (ts *AccessTokenService) TTL() time.Duration {
+	return time.Duration(util.GetEnvInt("ACCESS_TOKEN_TTL_MINUTES", 60, ts.app)) * time.Minute
+}
+
+// Issue returns a token that authorizes viewing the file without its password
+// until the returned expiry.
+func (ts *AccessTokenService) Issue(file *types.File) (string, time.Time, error) {
+	expiresAt := time.Now().Add(ts.TTL())
+	token, err := util.SignToken(accessTokenPurpose, accessTokenPayload{
+		CustomUrl: file.CustomUrl,
+		Password:  passwordFingerprint(file),
+		ExpiresAt: expiresAt.Unix(),
+	}, SigningSecret(ts.app))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return AccessTokenPrefix + token, expiresAt, nil
+}
+
+// Verify reports whether token is an unexpired access token for the file.
+func (ts *AccessTokenService) Verify(token string, file *types.File) bool {
+	token, found := strings.CutPrefix(token, AccessTokenPrefix)
+	if !found {
+		return false
+	}
+
+	var payload accessTokenPayload
+	if err := util.VerifyToken(token, accessTokenPurpose, SigningSecret(ts.app), &payload); err != nil {
+		return false
+	}
+	return payload.CustomUrl == file.CustomUrl &&
+		payload.Password == passwordFingerprint(file) &&
+		time.Now().Unix() < payload.ExpiresAt
+}
+
+// AccessCookieName is the cookie holding the access token for a customUrl.
+// The customUrl is hashed since it may contain characters cookies reject.
+func AccessCookieName(customUrl string) string {
+	sum := sha256.Sum256([]byte(customUrl))
+	return "imgnow_access_" + hex.EncodeToString(sum[:6])
+}
+
+func passwordFingerprint(file *types.File) string {
+	if file.Password == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(*file.Password))
+	return hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "0123456789abcdef0123456789abcdef"
+
+func TestCheckSigningSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{"unset", "", true},
+		{"too short", "secret", true},
+		{"long enough", testSigningSecret, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withEnv(t, map[string]string{"SIGNING_SECRET": tt.secret})
+			err := CheckSigningSecret(newTestApp())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccessTokenVerify(t *testing.T) {
+	withEnv(t, map[string]string{"SIGNING_SECRET": testSigningSecret})
+	testApp := newTestApp()
+	tokens := NewAccessTokenService(testApp)
+
+	password := "$2a$14$oldhash"
+	file := &types.File{Id: 1, CustomUrl: "cat", Password: &password}
+	token, expiresAt, err := tokens.Issue(file)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		t.Fatalf("token %q lacks the %s prefix", token, AccessTokenPrefix)
+	}
+	if until := time.Until(expiresAt); until <= 0 || until > tokens.TTL() {
+		t.Errorf("expires in %v, want within the %v TTL", until, tokens.TTL())
+	}
+
+	signed := func(purpose string, payload accessTokenPayload) string {
+		token, err := util.SignToken(purpose, payload, SigningSecret(testApp))
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return AccessTokenPrefix + token
+	}
+	changedPassword := "$2a$14$newhash"
+	shareToken, err := NewShareLinkService(testApp).Token(&types.ShareLink{Id: 1, FileId: file.Id})
+	if err != nil {
+		t.Fatalf("share token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		file  *types.File
+		want  bool
+	}{
+		{"valid", token, file, true},
+		{"without prefix", strings.TrimPrefix(token, AccessTokenPrefix), file, false},
+		{"tampered", token[:len(token)-2] + "xx", file, false},
+		{"other file", token, &types.File{Id: 2, CustomUrl: "dog", Password: &password}, false},
+		{"issued before a password change", token, &types.File{Id: 1, CustomUrl: "cat", Password: &changedPassword}, false},
+		{"issued before the password was removed", token, &types.File{Id: 1, CustomUrl: "cat"}, false},
+		{
+			"expired",
+			signed(accessTokenPurpose, accessTokenPayload{CustomUrl: "cat", Password: passwordFingerprint(file), ExpiresAt: time.Now().Add(-time.Second).Unix()}),
+			file,
+			false,
+		},
+		{
+			"signed for another purpose",
+			signed(shareLinkPurpose, accessTokenPayload{CustomUrl: "cat", Password: passwordFingerprint(file), ExpiresAt: time.Now().Add(time.Hour).Unix()}),
+			file,
+			false,
+		},
+		{"share link token", AccessTokenPrefix + shareToken, file, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tokens.Verify(tt.token, tt.file); got != tt.want {
+				t.Errorf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
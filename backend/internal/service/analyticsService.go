@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gabrielsy/imgnow/internal/app"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"time"
+)
+
+// Default number of days events are kept, overridable with
+// ANALYTICS_RETENTION_DAYS
+const defaultAnalyticsRetention = 90
+
+// Caps on the stats a single request may ask for
+const (
+	maxStatsBuckets   = 1000
+	statsBreakdownMax = 10
+)
+
+var ErrInvalidStatsRange = errors.New("invalid stats range")
+
+type AnalyticsService struct {
+	app *app.Application
+}
+
+func NewAnalyticsService(app *app.Application) *AnalyticsService {
+	return &AnalyticsService{app: app}
+}
+
+func (as *AnalyticsService) Retention() time.Duration {
+	return time.Duration(util.GetEnvInt("ANALYTICS_RETENTION_DAYS", defaultAnalyticsRetention, as.app)) * 24 * time.Hour
+}
+
+// Record logs a view or download of the file and notifies the owner's
+// webhooks. Only coarse, non-identifying details of the viewer are kept.
+// Failures are logged and otherwise ignored so they never fail the request
+// being recorded.
+func (as *AnalyticsService) Record(file *types.File, kind types.FileEventKind, viewer types.Viewer, shareLinkId *int) {
+	event := &types.FileEvent{
+		FileId:       file.Id,
+		Kind:         kind,
+		ShareLinkId:  shareLinkId,
+		ReferrerHost: util.ReferrerHost(viewer.Referrer),
+		ClientClass:  util.ClassifyClient(viewer.UserAgent),
+		Country:      CountryForIP(as.app, viewer.IP),
+	}
+
+	if err := fileRepo.RecordFileEvent(as.app, event); err != nil {
+		util.LogError(err, "Failed to record file event", as.app)
+	}
+
+	webhookEvent := types.WebhookFileViewed
+	if kind == types.EventDownload {
+		webhookEvent = types.WebhookFileDownloaded
+	}
+	NewWebhookService(as.app).Emit(file, webhookEvent, map[string]any{
+		"shareLinkId": shareLinkId,
+		"country":     event.Country,
+		"clientClass": event.ClientClass,
+	})
+}
+
+// Stats returns the file's views and downloads bucketed by interval ("hour"
+// or "day") between from and to, with its top countries, referrers and
+// client classes.
+func (as *AnalyticsService) Stats(file *types.File, interval string, from time.Time, to time.Time) (*types.FileStats, error) {
+	var step time.Duration
+	switch interval {
+	case "hour":
+		step = time.Hour
+	case "day":
+		step = 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("%w: interval must be hour or day", ErrInvalidStatsRange)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidStatsRange)
+	}
+	if to.Sub(from)/step > maxStatsBuckets {
+		return nil, fmt.Errorf("%w: range has too many buckets for the interval", ErrInvalidStatsRange)
+	}
+
+	stats := &types.FileStats{Interval: interval, From: from, To: to}
+
+	var err error
+	stats.Series, err = fileRepo.GetFileEventSeries(as.app, file.Id, interval, from, to)
+	if err != nil {
+		return nil, err
+	}
+	stats.Countries, err = fileRepo.GetFileEventBreakdown(as.app, file.Id, "country", from, to, statsBreakdownMax)
+	if err != nil {
+		return nil, err
+	}
+	stats.Referrers, err = fileRepo.GetFileEventBreakdown(as.app, file.Id, "referrer_host", from, to, statsBreakdownMax)
+	if err != nil {
+		return nil, err
+	}
+	stats.Clients, err = fileRepo.GetFileEventBreakdown(as.app, file.Id, "client_class", from, to, statsBreakdownMax)
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// DeleteExpiredEvents drops events older than the retention period.
+func (as *AnalyticsService) DeleteExpiredEvents() (int64, error) {
+	return fileRepo.DeleteFileEventsBefore(as.app, time.Now().Add(-as.Retention()))
+}
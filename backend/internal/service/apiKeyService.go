@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gabrielsy/imgnow/internal/app"
+	userRepo "gabrielsy/imgnow/internal/repository/user"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix marks bearer tokens that are API keys rather than sessions.
+const APIKeyPrefix = "imgnow_"
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+type APIKeyService struct {
+	app *app.Application
+}
+
+func NewAPIKeyService(app *app.Application) *APIKeyService {
+	return &APIKeyService{app: app}
+}
+
+// CreateKey issues a new key for the user. The returned secret is only
+// available here, the database keeps its hash.
+func (ks *APIKeyService) CreateKey(user *types.User, request types.CreateAPIKeyRequest) (*types.APIKey, string, error) {
+	for _, scope := range request.Scopes {
+		if !slices.Contains(types.AllScopes, scope) {
+			return nil, "", fmt.Errorf("unknown scope: %s", scope)
+		}
+	}
+
+	token, err := util.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	secret := APIKeyPrefix + token
+
+	key := &types.APIKey{
+		UserId:    user.Id,
+		Name:      strings.TrimSpace(request.Name),
+		Prefix:    secret[:len(APIKeyPrefix)+6],
+		KeyHash:   util.HashToken(secret),
+		Scopes:    request.Scopes,
+		CreatedAt: time.Now(),
+	}
+	err = userRepo.CreateAPIKey(ks.app, key)
+	if err != nil {
+		util.LogError(err, "Failed to create api key", ks.app)
+		return nil, "", err
+	}
+
+	return key, secret, nil
+}
+
+func (ks *APIKeyService) ListKeys(user *types.User) ([]*types.APIKey, error) {
+	keys, err := userRepo.ListAPIKeys(ks.app, user.Id)
+	if err != nil {
+		util.LogError(err, "Failed to list api keys", ks.app)
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (ks *APIKeyService) RevokeKey(user *types.User, id int) error {
+	revoked, err := userRepo.RevokeAPIKey(ks.app, user.Id, id)
+	if err != nil {
+		util.LogError(err, "Failed to revoke api key", ks.app)
+		return err
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves an API key to the key and its owner, recording the
+// use. It returns nils for unknown or revoked keys.
+func (ks *APIKeyService) Authenticate(secret string) (*types.APIKey, *types.User, error) {
+	key, err := userRepo.FindActiveAPIKey(ks.app, util.HashToken(secret))
+	if err != nil || key == nil {
+		return nil, nil, err
+	}
+
+	user, err := userRepo.FindUserById(ks.app, key.UserId)
+	if err != nil || user == nil {
+		return nil, nil, err
+	}
+
+	err = userRepo.TouchAPIKey(ks.app, key.Id)
+	util.LogError(err, "Failed to update api key last use", ks.app)
+
+	return key, user, nil
+}
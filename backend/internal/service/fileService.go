@@ -1,15 +1,20 @@
 package service
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"gabrielsy/imgnow/internal/app"
 	fileRepo "gabrielsy/imgnow/internal/repository/file"
 	"gabrielsy/imgnow/internal/types"
 	"gabrielsy/imgnow/internal/util"
 	"io"
-	"mime/multipart"
+	"os"
 	"strings"
 	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 type FileService struct {
@@ -28,37 +33,132 @@ func (fs *FileService) GetFileInfo(customUrl string) (*types.File, error) {
 	return file, nil
 }
 
-func (fs *FileService) UploadFile(file *multipart.FileHeader, customUrl string) error {
-	src, err := file.Open()
+// Default cap on a single upload, overridable with MAX_UPLOAD_SIZE
+const defaultMaxUploadSize = 512 << 20
+
+// SpooledUpload is an upload body written to a temporary file so it can be
+// processed after the request has returned.
+type SpooledUpload struct {
+	Path        string
+	Filename    string
+	ContentType string
+	Size        int64
+}
+
+func (su *SpooledUpload) Open() (*os.File, error) {
+	return os.Open(su.Path)
+}
+
+func (su *SpooledUpload) Remove() error {
+	return os.Remove(su.Path)
+}
+
+func (fs *FileService) MaxUploadSize() int64 {
+	return util.GetEnvInt("MAX_UPLOAD_SIZE", defaultMaxUploadSize, fs.app)
+}
+
+// RequiresProcessing reports whether uploads of contentType are transformed
+// before storage. Anything else is streamed straight to R2.
+func RequiresProcessing(contentType string) bool {
+	return strings.Contains(contentType, "image/jpeg") ||
+		strings.Contains(contentType, "image/jpg") ||
+		strings.Contains(contentType, "image/png") ||
+		strings.Contains(contentType, "video/") ||
+		strings.Contains(contentType, "audio/")
+}
+
+// SpoolUpload copies the upload body to a temporary file without holding it
+// in memory.
+func (fs *FileService) SpoolUpload(body io.Reader, filename string, contentType string) (*SpooledUpload, error) {
+	tmp, err := os.CreateTemp(util.GetEnv("UPLOAD_TMP_DIR", fs.app), "imgnow-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return &SpooledUpload{
+		Path:        tmp.Name(),
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+	}, nil
+}
+
+// StreamUpload sends an upload that needs no processing directly to R2 and
+// returns its size.
+func (fs *FileService) StreamUpload(body io.Reader, contentType string, customUrl string) (int64, error) {
+	r2 := NewR2Service(fs.app)
+	size, err := r2.UploadStreamToR2(body, contentType, customUrl)
+	if err != nil {
+		util.LogError(err, "Failed to stream file to R2", fs.app)
+		return 0, err
+	}
+	return size, nil
+}
+
+func (fs *FileService) UploadFile(upload *SpooledUpload, customUrl string) error {
+	src, err := upload.Open()
 	if err != nil {
 		return err
 	}
 	defer src.Close()
 
 	var body io.Reader = src
-	var contentLength int64 = file.Size
 
-	contentType := file.Header.Get("Content-Type")
+	contentType := upload.ContentType
 	if strings.Contains(contentType, "image/") {
 		is := NewImageService(fs.app)
-		body, contentLength, err = is.HandleImageCompression(file, contentType)
+		image, _, err := is.HandleImageCompression(src, upload.Size, contentType)
 		if err != nil {
 			util.LogError(err, "Failed to handle image compression", fs.app)
 			return err
 		}
+		body = image
+
+		// Dimensions are taken from what is stored, after any resizing
+		if width, height, err := ImageDimensions(image); err == nil {
+			if err := fileRepo.UpdateFileDimensions(fs.app, customUrl, width, height); err != nil {
+				util.LogError(err, "Failed to update image dimensions", fs.app)
+			}
+		}
+
+		if HasThumbnail(contentType) {
+			fs.uploadThumbnail(is, image, customUrl)
+		}
 	}
 
 	if strings.Contains(contentType, "video/") {
 		vs := NewVideoService(fs.app)
-		body, contentLength, err = vs.HandleVideoCompression(file)
+		if vs == nil {
+			return fmt.Errorf("video compression is unavailable")
+		}
+		defer vs.Close()
+		// The worker stores the compressed video itself, always as MP4
+		// whatever the uploaded container
+		_, err = vs.HandleVideoCompression(src, upload.Filename, contentType, customUrl)
 		if err != nil {
 			util.LogError(err, "Failed to handle video compression", vs.app)
 			return err
 		}
+		err = fileRepo.UpdateFileType(fs.app, customUrl, compressedVideoType)
+		if err != nil {
+			util.LogError(err, "Failed to update video type", fs.app)
+		}
+		return err
+	}
+
+	if strings.Contains(contentType, "audio/") {
+		return fs.uploadAudio(src, upload.Filename, contentType, customUrl)
 	}
 
 	r2 := NewR2Service(fs.app)
-	err = r2.UploadToR2(body, contentType, contentLength, customUrl)
+	_, err = r2.UploadStreamToR2(body, contentType, customUrl)
 	if err != nil {
 		util.LogError(err, "Failed to upload file to R2", fs.app)
 		return err
@@ -67,31 +167,124 @@ func (fs *FileService) UploadFile(file *multipart.FileHeader, customUrl string)
 	return nil
 }
 
-func (fs *FileService) TrackFileDownload(customUrl string) error {
-	err := fileRepo.IncrementDownloads(fs.app, customUrl)
+// uploadThumbnail stores the thumbnail of an image, leaving src at its
+// start. Thumbnails are optional, so failures are only logged.
+func (fs *FileService) uploadThumbnail(is *ImageService, src io.ReadSeeker, customUrl string) {
+	thumbnail, err := is.Thumbnail(src)
+	if _, seekErr := src.Seek(0, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	if err == nil {
+		err = NewR2Service(fs.app).UploadToR2(bytes.NewReader(thumbnail.Bytes()), "image/jpeg", int64(thumbnail.Len()), ThumbnailKey(customUrl))
+	}
+	if err != nil {
+		util.LogError(err, "Failed to create thumbnail", fs.app)
+	}
+}
+
+// WaveformImageKey and WaveformPeaksKey are the R2 keys of the previews
+// generated for audio uploads, stored next to the audio object itself.
+func WaveformImageKey(customUrl string) string {
+	return customUrl + ".waveform.png"
+}
+
+func WaveformPeaksKey(customUrl string) string {
+	return customUrl + ".waveform.json"
+}
+
+func (fs *FileService) uploadAudio(src io.Reader, originalName string, contentType string, customUrl string) error {
+	as := NewAudioService(fs.app)
+	if as == nil {
+		return fmt.Errorf("audio transcoding is unavailable")
+	}
+	defer as.Close()
+
+	// The worker stores the transcoded audio itself, only the previews are
+	// uploaded here
+	transcoded, err := as.HandleAudioTranscoding(src, originalName, contentType, customUrl)
+	if err != nil {
+		util.LogError(err, "Failed to handle audio transcoding", fs.app)
+		return err
+	}
+
+	r2 := NewR2Service(fs.app)
+	err = r2.UploadToR2(bytes.NewReader(transcoded.Waveform), "image/png", int64(len(transcoded.Waveform)), WaveformImageKey(customUrl))
 	if err != nil {
-		util.LogError(err, "Failed to track file download", fs.app)
+		util.LogError(err, "Failed to upload waveform image to R2", fs.app)
 		return err
 	}
 
-	// Check if file should be deleted based on download count
-	file, err := fileRepo.GetFileDeletionInfo(fs.app, customUrl)
+	peaks, err := json.Marshal(struct {
+		Duration float64   `json:"duration"`
+		Peaks    []float64 `json:"peaks"`
+	}{transcoded.Duration, transcoded.Peaks})
 	if err != nil {
-		util.LogError(err, "Failed to get file deletion info", fs.app)
 		return err
 	}
+	err = r2.UploadToR2(bytes.NewReader(peaks), "application/json", int64(len(peaks)), WaveformPeaksKey(customUrl))
+	if err != nil {
+		util.LogError(err, "Failed to upload waveform peaks to R2", fs.app)
+		return err
+	}
+
+	err = fileRepo.UpdateFileMedia(fs.app, customUrl, transcoded.ContentType, transcoded.Duration)
+	if err != nil {
+		util.LogError(err, "Failed to update audio metadata", fs.app)
+		return err
+	}
+
+	return nil
+}
+
+// ErrDownloadLimitReached is returned once a download-limited file has no
+// downloads left.
+var ErrDownloadLimitReached = errors.New("file has no downloads left")
+
+// DownloadFile claims a download of the file and only then opens the object
+// for streaming. Files with a view limit spend a view on every download as
+// well. When last is set it was the file's final download or view: the
+// file is already marked deleted and the caller removes it with DeleteFile
+// once the object has been sent. Crawler downloads are not counted, and
+// crawlers never get limited files.
+func (fs *FileService) DownloadFile(file *types.File, crawler bool, viewerKey string) (object *s3.GetObjectOutput, last bool, err error) {
+	if crawler && (file.DeletesAfterDownload || file.DeletesAfterVizualizations) {
+		return nil, false, ErrHiddenFromCrawlers
+	}
 
-	if file != nil && file.DeletesAfterDownload && file.DownloadsForDeletion != nil {
-		if file.Downloads >= *file.DownloadsForDeletion {
-			err = fs.DeleteFile(customUrl)
+	if !crawler {
+		var claimed bool
+		if file.DeletesAfterVizualizations {
+			claimed, last, err = fileRepo.ClaimViewedDownload(fs.app, file.CustomUrl, viewerKey, fs.UniqueViewWindow())
+		} else {
+			claimed, last, err = fileRepo.ClaimDownload(fs.app, file.CustomUrl)
+		}
+		if err != nil {
+			util.LogError(err, "Failed to track file download", fs.app)
+			return nil, false, err
+		}
+		if !claimed {
+			return nil, false, ErrDownloadLimitReached
+		}
+		if last {
+			err = fileRepo.MarkFileAsDeleted(fs.app, file.CustomUrl)
 			if err != nil {
-				util.LogError(err, "Failed to delete file after download limit", fs.app)
-				return err
+				util.LogError(err, "Failed to mark file as deleted", fs.app)
+				return nil, false, err
+			}
+			reason := "download_limit"
+			if file.DeletesAfterVizualizations {
+				reason = "view_limit"
 			}
+			NewWebhookService(fs.app).EmitFor(file.CustomUrl, types.WebhookFileDeleted, map[string]any{"reason": reason})
 		}
 	}
 
-	return nil
+	object, err = NewR2Service(fs.app).GetFromR2Stream(file.CustomUrl)
+	if err != nil {
+		util.LogError(err, "Failed to get file from R2", fs.app)
+		return nil, false, err
+	}
+	return object, last, nil
 }
 
 func (fs *FileService) UpdateFilePath(customUrl string) error {
@@ -114,6 +307,9 @@ func (fs *FileService) GenerateCustomUrl(urlName string) (string, error) {
 
 	// urlName provided, use it as url
 	if urlName != "" {
+		if strings.ContainsAny(urlName, "/?#") {
+			return "", fmt.Errorf("url name contains invalid characters")
+		}
 		exists, err := fileRepo.CustomUrlExists(fs.app, urlName)
 		if err != nil {
 			util.LogError(err, "Failed to check url name existence", fs.app)
@@ -166,34 +362,164 @@ func (fs *FileService) UpdateDeletionSettings(customUrl string, deletesAfterDown
 	return nil
 }
 
-// Returns true if file is available, false if it's not
-func (fs *FileService) TrackFileSettings(customUrl string) error {
-	err := fileRepo.IncrementVizualizations(fs.app, customUrl)
+// ErrViewLimitReached is returned once a view-limited file has no views left.
+var ErrViewLimitReached = errors.New("file has no views left")
+
+// ErrHiddenFromCrawlers is returned when a crawler asks for a file whose
+// views or downloads are limited, so previews cannot spend or leak them.
+var ErrHiddenFromCrawlers = errors.New("file is not available to crawlers")
+
+// Default lifetime of the URL issued for a file's last view, overridable
+// with BURN_URL_TTL_SECONDS
+const defaultBurnUrlTTL = 60
+
+// Default number of hours a viewer is counted once, overridable with
+// UNIQUE_VIEW_WINDOW_HOURS
+const defaultUniqueViewWindow = 24
+
+func (fs *FileService) BurnUrlTTL() time.Duration {
+	return time.Duration(util.GetEnvInt("BURN_URL_TTL_SECONDS", defaultBurnUrlTTL, fs.app)) * time.Second
+}
+
+func (fs *FileService) UniqueViewWindow() time.Duration {
+	return time.Duration(util.GetEnvInt("UNIQUE_VIEW_WINDOW_HOURS", defaultUniqueViewWindow, fs.app)) * time.Hour
+}
+
+// ViewerKey identifies a viewer for unique view counting by a keyed hash of
+// their IP and user agent.
+func ViewerKey(app *app.Application, viewer types.Viewer) string {
+	return util.Fingerprint(SigningSecret(app), viewer.IP, viewer.UserAgent)
+}
+
+// ViewedRecently reports whether the viewer claimed a view of the file within
+// the unique view window.
+func (fs *FileService) ViewedRecently(customUrl string, viewerKey string) (bool, error) {
+	seen, err := fileRepo.ViewerSeenSince(fs.app, customUrl, viewerKey, fs.UniqueViewWindow())
+	if err != nil {
+		util.LogError(err, "Failed to check file viewer", fs.app)
+	}
+	return seen, err
+}
+
+// claimView takes one of the file's views. When it was the last one the file
+// is marked deleted straight away, so no other request can be served it.
+func (fs *FileService) claimView(customUrl string, viewerKey string, shareLinkId *int) (last bool, err error) {
+	var claimed bool
+	if shareLinkId != nil {
+		var linkActive bool
+		linkActive, claimed, last, err = fileRepo.ClaimSharedVizualization(fs.app, customUrl, *shareLinkId, viewerKey, fs.UniqueViewWindow())
+		if err == nil && !linkActive {
+			return false, ErrShareLinkInactive
+		}
+	} else {
+		claimed, last, err = fileRepo.ClaimVizualization(fs.app, customUrl, viewerKey, fs.UniqueViewWindow())
+	}
 	if err != nil {
 		util.LogError(err, "Failed to track file visualization", fs.app)
-		return err
+		return false, err
+	}
+	if !claimed {
+		return false, ErrViewLimitReached
 	}
 
-	// Check if file should be deleted based on visualization count
-	file, err := fileRepo.GetFileDeletionInfo(fs.app, customUrl)
+	if last {
+		err = fileRepo.MarkFileAsDeleted(fs.app, customUrl)
+		if err != nil {
+			util.LogError(err, "Failed to mark file as deleted", fs.app)
+			return false, err
+		}
+		NewWebhookService(fs.app).EmitFor(customUrl, types.WebhookFileDeleted, map[string]any{"reason": "view_limit"})
+	}
+	return last, nil
+}
+
+// ViewFile claims a view of the file and only then issues a presigned URL
+// for it. The last view of a view-limited file gets a URL that expires after
+// BurnUrlTTL, and the file is removed from storage as soon as it does.
+func (fs *FileService) ViewFile(customUrl string, viewerKey string) (string, error) {
+	return fs.viewFile(customUrl, viewerKey, nil)
+}
+
+// ViewSharedFile is ViewFile through a share link, spending a view of the
+// link together with the file's. It fails with ErrShareLinkInactive, without
+// spending a file view, if the link was used up in the meantime.
+func (fs *FileService) ViewSharedFile(customUrl string, shareLinkId int, viewerKey string) (string, error) {
+	return fs.viewFile(customUrl, viewerKey, &shareLinkId)
+}
+
+func (fs *FileService) viewFile(customUrl string, viewerKey string, shareLinkId *int) (string, error) {
+	last, err := fs.claimView(customUrl, viewerKey, shareLinkId)
 	if err != nil {
-		util.LogError(err, "Failed to get file deletion info", fs.app)
-		return err
+		return "", err
 	}
 
-	if file != nil && file.DeletesAfterVizualizations && file.VizualizationsForDeletion != nil {
-		if file.Vizualizations >= *file.VizualizationsForDeletion {
-			err = fs.DeleteFile(customUrl)
-			if err != nil {
-				util.LogError(err, "Failed to delete file after visualization limit", fs.app)
-				return err
-			}
+	r2 := NewR2Service(fs.app)
+	if !last {
+		return r2.GetFromR2(customUrl)
+	}
+
+	// The removal deadline is stored as the file's expiry, so the expired
+	// files job still removes it if the server stops before the timer fires
+	ttl := fs.BurnUrlTTL()
+	removeAt := time.Now().Add(ttl)
+	if err := fileRepo.UpdateExpirationSettings(fs.app, customUrl, &removeAt); err != nil {
+		util.LogError(err, "Failed to store burned file removal time", fs.app)
+	}
+	time.AfterFunc(ttl, func() {
+		fs.deleteObjects(customUrl)
+	})
+	return r2.GetFromR2WithExpiry(customUrl, ttl)
+}
+
+// PreviewFile issues a URL for a crawler without counting a view. Files with
+// a view limit are never shown to crawlers.
+func (fs *FileService) PreviewFile(file *types.File) (string, error) {
+	if file.DeletesAfterVizualizations {
+		return "", ErrHiddenFromCrawlers
+	}
+	return NewR2Service(fs.app).GetFromR2(file.CustomUrl)
+}
+
+// ServeFile opens the object for a raw request, claiming a view first when
+// counted is set. last reports the file's final view, as for DownloadFile.
+// Crawlers never get view-limited files.
+func (fs *FileService) ServeFile(file *types.File, request R2ObjectRequest, counted bool, crawler bool, viewerKey string) (object *s3.GetObjectOutput, last bool, err error) {
+	if crawler && file.DeletesAfterVizualizations {
+		return nil, false, ErrHiddenFromCrawlers
+	}
+
+	if counted {
+		last, err = fs.claimView(file.CustomUrl, viewerKey, nil)
+		if err != nil {
+			return nil, false, err
 		}
 	}
 
+	object, err = NewR2Service(fs.app).GetFromR2Object(file.CustomUrl, request)
+	if err != nil {
+		if last {
+			fs.deleteObjects(file.CustomUrl)
+		}
+		return nil, false, err
+	}
+	return object, last, nil
+}
+
+// TrackFileSettings counts a view without issuing a URL, removing the file
+// from storage at once if it was the last view.
+func (fs *FileService) TrackFileSettings(customUrl string, viewerKey string) error {
+	last, err := fs.claimView(customUrl, viewerKey, nil)
+	if err != nil {
+		return err
+	}
+	if last {
+		fs.deleteObjects(customUrl)
+	}
 	return nil
 }
 
+// CleanupExpiredFiles deletes files whose expiry has passed, and removes
+// the storage of deleted files that was due to go by now but is still there.
 func (fs *FileService) CleanupExpiredFiles() error {
 	expiredFiles, err := fileRepo.GetExpiredFiles(fs.app)
 	if err != nil {
@@ -202,33 +528,164 @@ func (fs *FileService) CleanupExpiredFiles() error {
 	}
 
 	for _, file := range expiredFiles {
-		err = fs.DeleteFile(file.CustomUrl)
-		if err != nil {
-			util.LogError(err, "Failed to delete expired file", fs.app)
-			continue
-		}
+		fs.ExpireFile(file)
+	}
+
+	unremoved, err := fileRepo.GetUnremovedDeletedFiles(fs.app)
+	if err != nil {
+		util.LogError(err, "Failed to get deleted files left in storage", fs.app)
+		return err
+	}
+	for _, file := range unremoved {
+		fs.deleteObjects(file.CustomUrl)
 	}
 
 	return nil
 }
 
+// ExpireFile deletes a file whose expiry has passed and notifies the owner's
+// webhooks. The file is claimed first, so when several requests find it
+// expired at once only one of them deletes it and notifies. Failures are
+// logged.
+func (fs *FileService) ExpireFile(file *types.File) error {
+	claimed, err := fileRepo.ClaimExpiredFile(fs.app, file.CustomUrl)
+	if err != nil {
+		util.LogError(err, "Failed to mark expired file as deleted", fs.app)
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+
+	fs.deleteObjects(file.CustomUrl)
+	NewWebhookService(fs.app).Emit(file, types.WebhookFileExpired, nil)
+	return nil
+}
+
 func (fs *FileService) DeleteFile(customUrl string) error {
+	fs.deleteObjects(customUrl)
+
+	err := fileRepo.MarkFileAsDeleted(fs.app, customUrl)
+	if err != nil {
+		util.LogError(err, "Failed to mark file as deleted", fs.app)
+		return err
+	}
+
+	return nil
+}
+
+// deleteObjects removes the file and its previews from R2, logging failures.
+// Once the file itself is gone its storage is recorded as removed.
+func (fs *FileService) deleteObjects(customUrl string) {
 	r2 := NewR2Service(fs.app)
 	err := r2.DeleteFromR2(customUrl)
 	if err != nil {
 		util.LogError(err, "Failed to delete file from R2", fs.app)
+	} else if err := fileRepo.MarkStorageDeleted(fs.app, customUrl); err != nil {
+		util.LogError(err, "Failed to mark file storage as deleted", fs.app)
 	}
 
-	err = fileRepo.MarkFileAsDeleted(fs.app, customUrl)
-	if err != nil {
-		util.LogError(err, "Failed to mark file as deleted", fs.app)
-		return err
+	// Waveform previews only exist for audio and thumbnails for images,
+	// deleting a missing key is a no-op
+	for _, key := range []string{WaveformImageKey(customUrl), WaveformPeaksKey(customUrl), ThumbnailKey(customUrl)} {
+		if err := r2.DeleteFromR2(key); err != nil {
+			util.LogError(err, "Failed to delete preview from R2", fs.app)
+		}
+	}
+}
+
+// ErrInvalidSettings wraps settings rejected by validation, as opposed to
+// failures applying them.
+var ErrInvalidSettings = errors.New("invalid file settings")
+
+// MaxRetention is how long a file may be kept at most, 0 meaning forever.
+func (fs *FileService) MaxRetention() time.Duration {
+	return time.Duration(util.GetEnvInt("MAX_RETENTION_HOURS", 0, fs.app)) * time.Hour
+}
+
+// NormalizeSettings resolves ExpiresAfter into an absolute ExpiresIn counted
+// from createdAt and checks every expiry against the maximum retention. When
+// a maximum is configured and applyDefault is set, files without an expiry
+// get the maximum.
+func (fs *FileService) NormalizeSettings(request *types.FileSettings, createdAt time.Time, applyDefault bool) error {
+	if request.ExpiresIn != nil && request.ExpiresAfter != nil {
+		return fmt.Errorf("%w: expiresIn and expiresAfter are mutually exclusive", ErrInvalidSettings)
+	}
+
+	if request.ExpiresAfter != nil {
+		after, err := util.ParseRetention(*request.ExpiresAfter)
+		if err != nil {
+			return fmt.Errorf("%w: expiresAfter: %v", ErrInvalidSettings, err)
+		}
+		expiresIn := createdAt.Add(after)
+		request.ExpiresIn = &expiresIn
+		request.ExpiresAfter = nil
+	}
+
+	if request.BurnAfterReading {
+		if request.VizualizationsForDeletion != nil && *request.VizualizationsForDeletion != 1 {
+			return fmt.Errorf("%w: burnAfterReading allows a single view", ErrInvalidSettings)
+		}
+		once := 1
+		request.DeletesAfterVizualizations = true
+		request.VizualizationsForDeletion = &once
+	}
+
+	if request.ExpiresAfterFirstView != nil {
+		if _, err := util.ParseRetention(*request.ExpiresAfterFirstView); err != nil {
+			return fmt.Errorf("%w: expiresAfterFirstView: %v", ErrInvalidSettings, err)
+		}
 	}
 
+	if request.ExpiresIn != nil && request.ExpiresIn.Before(time.Now()) {
+		return fmt.Errorf("%w: expiry must be in the future", ErrInvalidSettings)
+	}
+
+	maxRetention := fs.MaxRetention()
+	if maxRetention <= 0 {
+		return nil
+	}
+	latest := createdAt.Add(maxRetention)
+	if request.ExpiresIn != nil && request.ExpiresIn.After(latest) {
+		return fmt.Errorf("%w: files can be kept for at most %s", ErrInvalidSettings, maxRetention)
+	}
+	if request.ExpiresIn == nil && applyDefault {
+		request.ExpiresIn = &latest
+	}
 	return nil
 }
 
+// ExpiresAfterViewSeconds returns the validated ExpiresAfterFirstView
+// setting in seconds, or nil when it is unset.
+func ExpiresAfterViewSeconds(request types.FileSettings) *int {
+	if request.ExpiresAfterFirstView == nil {
+		return nil
+	}
+	after, err := util.ParseRetention(*request.ExpiresAfterFirstView)
+	if err != nil {
+		return nil
+	}
+	seconds := int(after.Seconds())
+	return &seconds
+}
+
+// HandleConfiguration applies settings to a file. Settings are validated
+// first, relative expiries being counted from the file's creation.
 func (fs *FileService) HandleConfiguration(request types.FileSettings, customUrl string) error {
+	file, err := fileRepo.FindFileByCustomUrl(fs.app, customUrl)
+	if err != nil {
+		util.LogError(err, "Failed to find file", fs.app)
+		return err
+	}
+	if file == nil {
+		return fmt.Errorf("%w: file not found", ErrInvalidSettings)
+	}
+
+	err = fs.NormalizeSettings(&request, file.CreatedAt, false)
+	if err != nil {
+		return err
+	}
+
 	// Update expiration if provided
 	if request.ExpiresIn != nil {
 		err := fs.UpdateFileExpiration(customUrl, request.ExpiresIn)
@@ -238,6 +695,22 @@ func (fs *FileService) HandleConfiguration(request types.FileSettings, customUrl
 		}
 	}
 
+	if seconds := ExpiresAfterViewSeconds(request); seconds != nil {
+		err := fileRepo.UpdateExpiresAfterView(fs.app, customUrl, seconds)
+		if err != nil {
+			util.LogError(err, "Failed to update expiry after first view", fs.app)
+			return err
+		}
+	}
+
+	if request.CountUniqueViews != nil {
+		err := fileRepo.UpdateCountUniqueViews(fs.app, customUrl, *request.CountUniqueViews)
+		if err != nil {
+			util.LogError(err, "Failed to update unique view counting", fs.app)
+			return err
+		}
+	}
+
 	// Update deletion settings if any are provided
 	if request.DeletesAfterDownload || request.DeletesAfterVizualizations {
 		err := fs.UpdateDeletionSettings(
@@ -281,4 +754,4 @@ func (fs *FileService) VerifyPassword(customUrl string, password string) (bool,
 		return false, err
 	}
 	return util.CheckPasswordHash(password, *hashedPassword), nil
-}
\ No newline at end of file
+}
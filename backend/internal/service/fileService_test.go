@@ -0,0 +1,161 @@
+package service
+
+import (
+	"errors"
+	"gabrielsy/imgnow/internal/types"
+	"testing"
+	"time"
+)
+
+func TestNormalizeSettings(t *testing.T) {
+	createdAt := time.Now().Truncate(time.Second)
+	at := func(d time.Duration) *time.Time {
+		expiry := createdAt.Add(d)
+		return &expiry
+	}
+	text := func(value string) *string { return &value }
+	count := func(value int) *int { return &value }
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name         string
+		maxRetention string
+		settings     types.FileSettings
+		applyDefault bool
+		wantErr      bool
+		want         types.FileSettings
+	}{
+		{
+			name:     "1d",
+			settings: types.FileSettings{ExpiresAfter: text("1d")},
+			want:     types.FileSettings{ExpiresIn: at(day)},
+		},
+		{
+			name:     "7d",
+			settings: types.FileSettings{ExpiresAfter: text("7d")},
+			want:     types.FileSettings{ExpiresIn: at(7 * day)},
+		},
+		{
+			name:     "absolute expiry",
+			settings: types.FileSettings{ExpiresIn: at(time.Hour)},
+			want:     types.FileSettings{ExpiresIn: at(time.Hour)},
+		},
+		{
+			name:     "no expiry without a maximum",
+			settings: types.FileSettings{},
+			want:     types.FileSettings{},
+		},
+		{
+			name:     "invalid expiresAfter",
+			settings: types.FileSettings{ExpiresAfter: text("soon")},
+			wantErr:  true,
+		},
+		{
+			name:     "expiresAfter without unit",
+			settings: types.FileSettings{ExpiresAfter: text("7")},
+			wantErr:  true,
+		},
+		{
+			name:     "both expiries",
+			settings: types.FileSettings{ExpiresIn: at(time.Hour), ExpiresAfter: text("1d")},
+			wantErr:  true,
+		},
+		{
+			name:     "expiry in the past",
+			settings: types.FileSettings{ExpiresIn: at(-time.Hour)},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid expiresAfterFirstView",
+			settings: types.FileSettings{ExpiresAfterFirstView: text("0h")},
+			wantErr:  true,
+		},
+		{
+			name:     "burn after reading",
+			settings: types.FileSettings{BurnAfterReading: true},
+			want:     types.FileSettings{BurnAfterReading: true, DeletesAfterVizualizations: true, VizualizationsForDeletion: count(1)},
+		},
+		{
+			name:     "burn after reading with more views",
+			settings: types.FileSettings{BurnAfterReading: true, VizualizationsForDeletion: count(3)},
+			wantErr:  true,
+		},
+		{
+			name:         "within MAX_RETENTION_HOURS",
+			maxRetention: "168",
+			settings:     types.FileSettings{ExpiresAfter: text("7d")},
+			want:         types.FileSettings{ExpiresIn: at(7 * day)},
+		},
+		{
+			name:         "beyond MAX_RETENTION_HOURS",
+			maxRetention: "24",
+			settings:     types.FileSettings{ExpiresAfter: text("7d")},
+			wantErr:      true,
+		},
+		{
+			name:         "absolute expiry beyond MAX_RETENTION_HOURS",
+			maxRetention: "24",
+			settings:     types.FileSettings{ExpiresIn: at(2 * day)},
+			wantErr:      true,
+		},
+		{
+			name:         "MAX_RETENTION_HOURS as the default",
+			maxRetention: "24",
+			settings:     types.FileSettings{},
+			applyDefault: true,
+			want:         types.FileSettings{ExpiresIn: at(day)},
+		},
+		{
+			name:         "no default when updating",
+			maxRetention: "24",
+			settings:     types.FileSettings{},
+			want:         types.FileSettings{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withEnv(t, map[string]string{"MAX_RETENTION_HOURS": tt.maxRetention})
+			fs := NewFileService(newTestApp())
+
+			settings := tt.settings
+			err := fs.NormalizeSettings(&settings, createdAt, tt.applyDefault)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSettings) {
+					t.Errorf("err = %v, want ErrInvalidSettings", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalize: %v", err)
+			}
+
+			if settings.ExpiresAfter != nil {
+				t.Errorf("ExpiresAfter = %q, want it resolved", *settings.ExpiresAfter)
+			}
+			if !equalTime(settings.ExpiresIn, tt.want.ExpiresIn) {
+				t.Errorf("ExpiresIn = %v, want %v", settings.ExpiresIn, tt.want.ExpiresIn)
+			}
+			if settings.DeletesAfterVizualizations != tt.want.DeletesAfterVizualizations {
+				t.Errorf("DeletesAfterVizualizations = %v, want %v", settings.DeletesAfterVizualizations, tt.want.DeletesAfterVizualizations)
+			}
+			if !equalInt(settings.VizualizationsForDeletion, tt.want.VizualizationsForDeletion) {
+				t.Errorf("VizualizationsForDeletion = %v, want %v", settings.VizualizationsForDeletion, tt.want.VizualizationsForDeletion)
+			}
+		})
+	}
+}
+
+func equalTime(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func equalInt(a *int, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/util"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type geoIPRange struct {
+	start   netip.Addr
+	end     netip.Addr
+	country string
+}
+
+// The GeoIP database is loaded once per process on first use.
+var geoIP struct {
+	once   sync.Once
+	ranges []geoIPRange
+}
+
+// CountryForIP looks the IP up in the offline GeoIP database at
+// GEOIP_DB_PATH, returning nil when no database is configured or the IP is
+// not in it. The database is a CSV of "start_ip,end_ip,country_code" rows,
+// the layout of the freely available IP-to-country range files.
+func CountryForIP(app *app.Application, ip string) *string {
+	geoIP.once.Do(func() {
+		path := util.GetEnv("GEOIP_DB_PATH", app)
+		if path == "" {
+			return
+		}
+		ranges, err := loadGeoIPRanges(path)
+		if err != nil {
+			util.LogError(err, "Failed to load GeoIP database", app)
+			return
+		}
+		geoIP.ranges = ranges
+	})
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || len(geoIP.ranges) == 0 {
+		return nil
+	}
+	addr = addr.Unmap()
+
+	// Last range starting at or before the address
+	i := sort.Search(len(geoIP.ranges), func(i int) bool {
+		return geoIP.ranges[i].start.Compare(addr) > 0
+	}) - 1
+	if i < 0 || geoIP.ranges[i].end.Compare(addr) < 0 {
+		return nil
+	}
+	return &geoIP.ranges[i].country
+}
+
+func loadGeoIPRanges(path string) ([]geoIPRange, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	var ranges []geoIPRange
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			continue
+		}
+
+		// Skips the header and malformed rows
+		start, startErr := netip.ParseAddr(strings.TrimSpace(record[0]))
+		end, endErr := netip.ParseAddr(strings.TrimSpace(record[1]))
+		country := strings.ToUpper(strings.TrimSpace(record[2]))
+		if startErr != nil || endErr != nil || len(country) != 2 {
+			continue
+		}
+		ranges = append(ranges, geoIPRange{start: start.Unmap(), end: end.Unmap(), country: country})
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("no ranges found in GeoIP database")
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Less(ranges[j].start)
+	})
+	return ranges, nil
+}
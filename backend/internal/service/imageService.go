@@ -6,15 +6,40 @@ import (
 	"gabrielsy/imgnow/internal/app"
 	"gabrielsy/imgnow/internal/util"
 	"image"
+	_ "image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
-	"mime/multipart"
 	"strings"
 
 	"github.com/nfnt/resize"
 )
 
+// Roughly 160MB once decoded as RGBA
+const defaultMaxImagePixels = 40_000_000
+
+// Longest side of the thumbnails stored for images
+const thumbnailSize = 320
+
+// thumbnailTypes are the image types a thumbnail is made for, those that
+// can be decoded.
+var thumbnailTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// HasThumbnail reports whether a thumbnail is made for files of the type.
+func HasThumbnail(contentType string) bool {
+	return thumbnailTypes[contentType]
+}
+
+// ThumbnailKey is the R2 key of the thumbnail of an image, stored next to
+// the image itself.
+func ThumbnailKey(customUrl string) string {
+	return customUrl + ".thumbnail.jpg"
+}
+
 type ImageService struct {
 	app *app.Application
 }
@@ -23,12 +48,34 @@ func NewImageService(app *app.Application) *ImageService {
 	return &ImageService{app: app}
 }
 
-func (is *ImageService) CompressImage(src multipart.File, contentType string) (*bytes.Buffer, error) {
+// decodeImage decodes src from its start, refusing images whose header
+// announces more than MAX_IMAGE_PIXELS.
+func (is *ImageService) decodeImage(src io.ReadSeeker) (image.Image, error) {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek file: %w", err)
+	}
+
+	// Check the dimensions from the header before decoding, a small file can
+	// still expand to an enormous bitmap in memory
+	cfg, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return nil, err
+	}
+	maxPixels := util.GetEnvInt("MAX_IMAGE_PIXELS", defaultMaxImagePixels, is.app)
+	if int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, fmt.Errorf("image too large to compress: %dx%d", cfg.Width, cfg.Height)
+	}
+
 	if _, err := src.Seek(0, io.SeekStart); err != nil {
 		return nil, fmt.Errorf("failed to seek file: %w", err)
 	}
 
 	img, _, err := image.Decode(src)
+	return img, err
+}
+
+func (is *ImageService) CompressImage(src io.ReadSeeker, contentType string) (*bytes.Buffer, error) {
+	img, err := is.decodeImage(src)
 	if err != nil {
 		return nil, err
 	}
@@ -64,28 +111,51 @@ func (is *ImageService) CompressImage(src multipart.File, contentType string) (*
 	return compressed, nil
 }
 
-func (is *ImageService) HandleImageCompression(file *multipart.FileHeader, contentType string) (io.Reader, int64, error) {
-	src, err := file.Open()
+// Thumbnail scales the image down to fit thumbnailSize and encodes it as
+// JPEG.
+func (is *ImageService) Thumbnail(src io.ReadSeeker) (*bytes.Buffer, error) {
+	img, err := is.decodeImage(src)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
-	defer src.Close()
 
-	var body io.Reader = src
-	var contentLength int64 = file.Size
+	thumbnail := &bytes.Buffer{}
+	err = jpeg.Encode(thumbnail, resize.Thumbnail(thumbnailSize, thumbnailSize, img, resize.Lanczos3), &jpeg.Options{Quality: 80})
+	if err != nil {
+		return nil, err
+	}
+	return thumbnail, nil
+}
+
+func (is *ImageService) HandleImageCompression(src io.ReadSeeker, size int64, contentType string) (io.ReadSeeker, int64, error) {
+	var body io.ReadSeeker = src
+	var contentLength int64 = size
 
 	compressedBody, err := is.CompressImage(src, contentType)
 	if err != nil {
 		util.LogError(err, "Could not compress image, using original", is.app)
-	} else {
-		if int64(compressedBody.Len()) < file.Size {
-			body = compressedBody
-			contentLength = int64(compressedBody.Len())
-		} else {
-			if _, err := src.Seek(0, io.SeekStart); err != nil {
-				return nil, 0, fmt.Errorf("failed to seek original file after failed compression: %w", err)
-			}
-		}
+	} else if int64(compressedBody.Len()) < size {
+		return bytes.NewReader(compressedBody.Bytes()), int64(compressedBody.Len()), nil
+	}
+
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("failed to seek original file after failed compression: %w", err)
 	}
 	return body, contentLength, nil
 }
+
+// ImageDimensions reads the width and height from the image header, leaving
+// src at its start.
+func ImageDimensions(src io.ReadSeeker) (int, int, error) {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	cfg, _, err := image.DecodeConfig(src)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
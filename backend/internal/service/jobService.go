@@ -0,0 +1,138 @@
+package service
+
+import (
+	"gabrielsy/imgnow/internal/app"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	rateLimitRepo "gabrielsy/imgnow/internal/repository/ratelimit"
+	userRepo "gabrielsy/imgnow/internal/repository/user"
+	"gabrielsy/imgnow/internal/util"
+	"time"
+)
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      func(app *app.Application) error
+}
+
+// jobs are the maintenance tasks run in the background for the lifetime of
+// the server.
+var jobs = []job{
+	{
+		name:     "cleanup orphaned multipart uploads",
+		interval: time.Hour,
+		run: func(app *app.Application) error {
+			maxAge := time.Duration(util.GetEnvInt("R2_MULTIPART_MAX_AGE_HOURS", 24, app)) * time.Hour
+			aborted, err := NewR2Service(app).CleanupMultipartUploads(maxAge)
+			if aborted > 0 {
+				app.Logger.Printf("Aborted %d orphaned multipart uploads", aborted)
+			}
+			return err
+		},
+	},
+	{
+		name:     "cleanup orphaned processing uploads",
+		interval: time.Hour,
+		run: func(app *app.Application) error {
+			// Staged uploads outlive their processing only when the server
+			// stopped before removing them
+			deleted, err := NewR2Service(app).DeleteStaleObjects(processingPrefix, mediaURLTTL)
+			if deleted > 0 {
+				app.Logger.Printf("Deleted %d orphaned processing uploads", deleted)
+			}
+			return err
+		},
+	},
+	{
+		name:     "delete expired sessions",
+		interval: time.Hour,
+		run: func(app *app.Application) error {
+			return userRepo.DeleteExpiredSessions(app)
+		},
+	},
+	{
+		name:     "purge trashed files",
+		interval: 15 * time.Minute,
+		run: func(app *app.Application) error {
+			purged, err := NewTrashService(app).PurgeTrash()
+			if purged > 0 {
+				app.Logger.Printf("Purged %d trashed files", purged)
+			}
+			return err
+		},
+	},
+	{
+		name:     "anonymize deleted files",
+		interval: time.Hour,
+		run: func(app *app.Application) error {
+			purged, err := NewTrashService(app).PurgeDeleted()
+			if purged > 0 {
+				app.Logger.Printf("Anonymized %d deleted files", purged)
+			}
+			return err
+		},
+	},
+	{
+		name:     "delete expired analytics events",
+		interval: time.Hour,
+		run: func(app *app.Application) error {
+			_, err := NewAnalyticsService(app).DeleteExpiredEvents()
+			return err
+		},
+	},
+	{
+		name:     "forget unique viewers",
+		interval: time.Hour,
+		run: func(app *app.Application) error {
+			window := NewFileService(app).UniqueViewWindow()
+			return fileRepo.DeleteFileViewersBefore(app, time.Now().Add(-window))
+		},
+	},
+	{
+		name:     "delete expired files",
+		interval: 15 * time.Minute,
+		run: func(app *app.Application) error {
+			return NewFileService(app).CleanupExpiredFiles()
+		},
+	},
+	{
+		name:     "retry webhook deliveries",
+		interval: time.Minute,
+		run: func(app *app.Application) error {
+			_, err := NewWebhookService(app).RetryDue()
+			return err
+		},
+	},
+	{
+		name:     "delete old webhook deliveries",
+		interval: time.Hour,
+		run: func(app *app.Application) error {
+			return NewWebhookService(app).DeleteOldDeliveries()
+		},
+	},
+	{
+		name:     "delete idle rate limit buckets",
+		interval: time.Hour,
+		run: func(app *app.Application) error {
+			return rateLimitRepo.DeleteIdleBuckets(app, time.Now().Add(-time.Hour))
+		},
+	},
+}
+
+func StartJobs(app *app.Application) {
+	for _, j := range jobs {
+		go runJob(app, j)
+	}
+}
+
+func runJob(app *app.Application, j job) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := j.run(app); err != nil {
+			util.LogError(err, "Job failed: "+j.name, app)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"gabrielsy/imgnow/internal/app"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"time"
+)
+
+// PasswordGuardService protects password-protected files against online
+// guessing. Each failure from an IP doubles the wait before that IP may try
+// the file again, and too many failures lock the file (from any IP) or the IP
+// (on any file) until the attempt window has passed or the owner unlocks it.
+type PasswordGuardService struct {
+	app *app.Application
+}
+
+func NewPasswordGuardService(app *app.Application) *PasswordGuardService {
+	return &PasswordGuardService{app: app}
+}
+
+func (gs *PasswordGuardService) window() time.Duration {
+	return time.Duration(util.GetEnvInt("PASSWORD_ATTEMPT_WINDOW_MINUTES", 15, gs.app)) * time.Minute
+}
+
+// Reserve decides whether ip may attempt the file's password now and, when
+// it may, records the attempt as a failure before the password is compared,
+// so parallel guesses cannot all slip through the same check. The attempt is
+// forgotten by Succeeded if the password was right.
+func (gs *PasswordGuardService) Reserve(file *types.File, ip string, userAgent string) (*types.PasswordGate, error) {
+	now := time.Now()
+	window := gs.window()
+
+	var gate *types.PasswordGate
+	attemptId, err := fileRepo.ReservePasswordAttempt(gs.app, file.Id, ip, userAgent, now, now.Add(-window), func(stats *types.PasswordFailureStats) bool {
+		gate = gs.gate(stats, now, window)
+		return gate.Allowed
+	})
+	if err != nil {
+		util.LogError(err, "Failed to reserve password attempt", gs.app)
+		return nil, err
+	}
+	gate.AttemptId = attemptId
+	return gate, nil
+}
+
+func (gs *PasswordGuardService) gate(stats *types.PasswordFailureStats, now time.Time, window time.Duration) *types.PasswordGate {
+	fileLimit := int(util.GetEnvInt("PASSWORD_FILE_LOCKOUT_ATTEMPTS", 20, gs.app))
+	if stats.FileFailures >= fileLimit {
+		return &types.PasswordGate{Locked: true, RetryAfter: stats.LastFileFailure.Add(window).Sub(now)}
+	}
+
+	ipLimit := int(util.GetEnvInt("PASSWORD_IP_LOCKOUT_ATTEMPTS", 10, gs.app))
+	if stats.IPFailures >= ipLimit {
+		return &types.PasswordGate{Locked: true, RetryAfter: stats.LastIPFailure.Add(window).Sub(now)}
+	}
+
+	if stats.PairFailures > 0 {
+		delay := gs.delay(stats.PairFailures)
+		if wait := stats.LastPairFailure.Add(delay).Sub(now); wait > 0 {
+			return &types.PasswordGate{RetryAfter: wait}
+		}
+	}
+
+	return &types.PasswordGate{Allowed: true}
+}
+
+// delay is the wait imposed after the given number of consecutive failures.
+func (gs *PasswordGuardService) delay(failures int) time.Duration {
+	base := time.Duration(util.GetEnvInt("PASSWORD_DELAY_BASE_SECONDS", 1, gs.app)) * time.Second
+	maxDelay := time.Duration(util.GetEnvInt("PASSWORD_DELAY_MAX_SECONDS", 60, gs.app)) * time.Second
+
+	delay := base
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// Succeeded forgets the reserved attempt, which had the right password, and
+// resets the delay for the IP.
+func (gs *PasswordGuardService) Succeeded(file *types.File, ip string, gate *types.PasswordGate) {
+	err := fileRepo.DeletePasswordAttempt(gs.app, gate.AttemptId)
+	util.LogError(err, "Failed to delete password attempt", gs.app)
+
+	err = fileRepo.ClearPasswordFailures(gs.app, file.Id, &ip)
+	util.LogError(err, "Failed to clear password failures", gs.app)
+}
+
+func (gs *PasswordGuardService) ListAttempts(file *types.File) ([]*types.PasswordAttempt, error) {
+	attempts, err := fileRepo.ListPasswordAttempts(gs.app, file.Id, 200)
+	if err != nil {
+		util.LogError(err, "Failed to list password attempts", gs.app)
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// Unlock lifts every delay and lockout on the file.
+func (gs *PasswordGuardService) Unlock(file *types.File) error {
+	err := fileRepo.ClearPasswordFailures(gs.app, file.Id, nil)
+	if err != nil {
+		util.LogError(err, "Failed to unlock file", gs.app)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"fmt"
+	"gabrielsy/imgnow/internal/types"
+	"testing"
+	"time"
+)
+
+// guardEnv pins the password guard settings the tests expect.
+var guardEnv = map[string]string{
+	"PASSWORD_FILE_LOCKOUT_ATTEMPTS": "20",
+	"PASSWORD_IP_LOCKOUT_ATTEMPTS":   "10",
+	"PASSWORD_DELAY_BASE_SECONDS":    "1",
+	"PASSWORD_DELAY_MAX_SECONDS":     "60",
+}
+
+func TestPasswordGuardDelay(t *testing.T) {
+	withEnv(t, guardEnv)
+	guard := NewPasswordGuardService(newTestApp())
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{6, 32 * time.Second},
+		{7, 60 * time.Second},
+		{50, 60 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d failures", tt.failures), func(t *testing.T) {
+			if got := guard.delay(tt.failures); got != tt.want {
+				t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordGuardGate(t *testing.T) {
+	withEnv(t, guardEnv)
+	guard := NewPasswordGuardService(newTestApp())
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := 15 * time.Minute
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+
+	tests := []struct {
+		name  string
+		stats types.PasswordFailureStats
+		want  types.PasswordGate
+	}{
+		{
+			name:  "no failures",
+			stats: types.PasswordFailureStats{},
+			want:  types.PasswordGate{Allowed: true},
+		},
+		{
+			name:  "first failure still delayed",
+			stats: types.PasswordFailureStats{FileFailures: 1, LastFileFailure: ago(0), IPFailures: 1, LastIPFailure: ago(0), PairFailures: 1, LastPairFailure: ago(0)},
+			want:  types.PasswordGate{RetryAfter: time.Second},
+		},
+		{
+			name:  "delay doubles with each failure",
+			stats: types.PasswordFailureStats{FileFailures: 3, LastFileFailure: ago(time.Second), IPFailures: 3, LastIPFailure: ago(time.Second), PairFailures: 3, LastPairFailure: ago(time.Second)},
+			want:  types.PasswordGate{RetryAfter: 3 * time.Second},
+		},
+		{
+			name:  "delay passed",
+			stats: types.PasswordFailureStats{FileFailures: 3, LastFileFailure: ago(5 * time.Second), IPFailures: 3, LastIPFailure: ago(5 * time.Second), PairFailures: 3, LastPairFailure: ago(5 * time.Second)},
+			want:  types.PasswordGate{Allowed: true},
+		},
+		{
+			name:  "failures from other IPs do not delay",
+			stats: types.PasswordFailureStats{FileFailures: 5, LastFileFailure: ago(0)},
+			want:  types.PasswordGate{Allowed: true},
+		},
+		{
+			name:  "file locked from any IP",
+			stats: types.PasswordFailureStats{FileFailures: 20, LastFileFailure: ago(5 * time.Minute)},
+			want:  types.PasswordGate{Locked: true, RetryAfter: 10 * time.Minute},
+		},
+		{
+			name:  "IP locked on any file",
+			stats: types.PasswordFailureStats{FileFailures: 1, LastFileFailure: ago(time.Hour), IPFailures: 10, LastIPFailure: ago(time.Minute)},
+			want:  types.PasswordGate{Locked: true, RetryAfter: 14 * time.Minute},
+		},
+		{
+			name:  "file lock wins over the IP lock",
+			stats: types.PasswordFailureStats{FileFailures: 20, LastFileFailure: ago(time.Minute), IPFailures: 10, LastIPFailure: ago(10 * time.Minute)},
+			want:  types.PasswordGate{Locked: true, RetryAfter: 14 * time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := guard.gate(&tt.stats, now, window)
+			if *gate != tt.want {
+				t.Errorf("gate = %+v, want %+v", *gate, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordGuardUnlock(t *testing.T) {
+	testApp := testDB(t)
+	withEnv(t, guardEnv)
+	guard := NewPasswordGuardService(testApp)
+
+	file := &types.File{CustomUrl: fmt.Sprintf("guard-test-%d", time.Now().UnixNano())}
+	err := testApp.DB.QueryRow(`INSERT INTO file (custom_url, original_name, size, type, status)
+		VALUES ($1, 'test', 0, 'text/plain', $2) RETURNING id`, file.CustomUrl, types.Active).Scan(&file.Id)
+	if err != nil {
+		t.Fatalf("create file: %v", err)
+	}
+	t.Cleanup(func() {
+		testApp.DB.Exec(`DELETE FROM file WHERE id = $1`, file.Id)
+	})
+
+	ip := "192.0.2.1"
+	gate, err := guard.Reserve(file, ip, "test")
+	if err != nil || !gate.Allowed {
+		t.Fatalf("first attempt: %+v, %v", gate, err)
+	}
+
+	gate, err = guard.Reserve(file, ip, "test")
+	if err != nil {
+		t.Fatalf("second attempt: %v", err)
+	}
+	if gate.Allowed || gate.RetryAfter <= 0 {
+		t.Fatalf("second attempt right after a failure = %+v, want a delay", gate)
+	}
+
+	if err := guard.Unlock(file); err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+
+	gate, err = guard.Reserve(file, ip, "test")
+	if err != nil || !gate.Allowed {
+		t.Errorf("attempt after unlocking = %+v, %v, want allowed", gate, err)
+	}
+}
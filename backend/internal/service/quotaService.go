@@ -0,0 +1,56 @@
+package service
+
+import (
+	"gabrielsy/imgnow/internal/app"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"time"
+)
+
+const (
+	defaultQuotaBytes       = 1 << 30
+	defaultQuotaFilesPerDay = 100
+	quotaWindow             = 24 * time.Hour
+)
+
+type QuotaService struct {
+	app *app.Application
+}
+
+func NewQuotaService(app *app.Application) *QuotaService {
+	return &QuotaService{app: app}
+}
+
+func (qs *QuotaService) Usage(uploader string) (*types.QuotaUsage, error) {
+	now := time.Now()
+	bytesUsed, filesToday, oldest, err := fileRepo.GetUploaderUsage(qs.app, uploader, now.Add(-quotaWindow))
+	if err != nil {
+		util.LogError(err, "Failed to get uploader usage", qs.app)
+		return nil, err
+	}
+
+	usage := &types.QuotaUsage{
+		BytesUsed:  bytesUsed,
+		BytesLimit: util.GetEnvInt("QUOTA_MAX_BYTES", defaultQuotaBytes, qs.app),
+		FilesToday: filesToday,
+		FilesLimit: int(util.GetEnvInt("QUOTA_MAX_FILES_PER_DAY", defaultQuotaFilesPerDay, qs.app)),
+	}
+	if usage.FilesLimit > 0 && usage.FilesToday >= usage.FilesLimit && oldest != nil {
+		usage.RetryAfter = oldest.Add(quotaWindow).Sub(now)
+	}
+	return usage, nil
+}
+
+// FilesExceeded reports whether another upload would go over the daily quota.
+func FilesExceeded(usage *types.QuotaUsage) bool {
+	return usage.FilesLimit > 0 && usage.FilesToday >= usage.FilesLimit
+}
+
+// RemainingBytes is how much more the uploader may store, or -1 if unlimited.
+func RemainingBytes(usage *types.QuotaUsage) int64 {
+	if usage.BytesLimit <= 0 {
+		return -1
+	}
+	return max(usage.BytesLimit-usage.BytesUsed, 0)
+}
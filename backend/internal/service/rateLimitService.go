@@ -0,0 +1,164 @@
+package service
+
+import (
+	"gabrielsy/imgnow/internal/app"
+	rateLimitRepo "gabrielsy/imgnow/internal/repository/ratelimit"
+	"gabrielsy/imgnow/internal/util"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket policy: Burst requests at once, refilled at
+// PerMinute requests per minute.
+type RateLimit struct {
+	Name      string
+	PerMinute float64
+	Burst     int
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+	// Time until the bucket is full again
+	Reset time.Duration
+}
+
+type RateLimitStore interface {
+	Take(limit RateLimit, key string) (RateLimitResult, error)
+}
+
+// takeToken refills a bucket holding tokens since updatedAt and takes one
+// token from it when available.
+func takeToken(limit RateLimit, tokens float64, updatedAt time.Time, now time.Time) (float64, bool) {
+	perSecond := limit.PerMinute / 60
+	tokens = math.Min(float64(limit.Burst), tokens+now.Sub(updatedAt).Seconds()*perSecond)
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
+
+func rateLimitResult(limit RateLimit, tokens float64, allowed bool) RateLimitResult {
+	perSecond := limit.PerMinute / 60
+	result := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     time.Duration((float64(limit.Burst) - tokens) / perSecond * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	}
+	return result
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in process memory. Limits are per server
+// instance and reset on restart.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*bucket{}, swept: time.Now()}
+}
+
+func (ms *MemoryRateLimitStore) Take(limit RateLimit, key string) (RateLimitResult, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	ms.sweep(now)
+
+	key = limit.Name + ":" + key
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		ms.buckets[key] = b
+	}
+
+	tokens, allowed := takeToken(limit, b.tokens, b.updatedAt, now)
+	b.tokens = tokens
+	b.updatedAt = now
+
+	return rateLimitResult(limit, tokens, allowed), nil
+}
+
+// sweep drops buckets idle for over an hour so the map does not grow with
+// every client ever seen.
+func (ms *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(ms.swept) < time.Minute {
+		return
+	}
+	ms.swept = now
+	for key, b := range ms.buckets {
+		if now.Sub(b.updatedAt) > time.Hour {
+			delete(ms.buckets, key)
+		}
+	}
+}
+
+// PostgresRateLimitStore keeps buckets in the database so limits hold across
+// several server instances.
+type PostgresRateLimitStore struct {
+	app *app.Application
+}
+
+func NewPostgresRateLimitStore(app *app.Application) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{app: app}
+}
+
+func (ps *PostgresRateLimitStore) Take(limit RateLimit, key string) (RateLimitResult, error) {
+	now := time.Now()
+	allowed, tokens, err := rateLimitRepo.TakeToken(ps.app, limit.Name+":"+key, limit.Burst, now, func(tokens float64, updatedAt time.Time) (float64, bool) {
+		return takeToken(limit, tokens, updatedAt, now)
+	})
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return rateLimitResult(limit, tokens, allowed), nil
+}
+
+func UploadRateLimit(app *app.Application) RateLimit {
+	return RateLimit{
+		Name:      "upload",
+		PerMinute: float64(util.GetEnvInt("RATE_LIMIT_UPLOADS_PER_MINUTE", 10, app)),
+		Burst:     int(util.GetEnvInt("RATE_LIMIT_UPLOAD_BURST", 10, app)),
+	}
+}
+
+// PasswordRateLimit throttles password attempts on protected files, each of
+// which costs a bcrypt comparison.
+func PasswordRateLimit(app *app.Application) RateLimit {
+	return RateLimit{
+		Name:      "password",
+		PerMinute: float64(util.GetEnvInt("RATE_LIMIT_PASSWORD_PER_MINUTE", 5, app)),
+		Burst:     int(util.GetEnvInt("RATE_LIMIT_PASSWORD_BURST", 5, app)),
+	}
+}
+
+// AuthRateLimit throttles logins and registrations, each of which costs a
+// bcrypt hash or comparison.
+func AuthRateLimit(app *app.Application) RateLimit {
+	return RateLimit{
+		Name:      "auth",
+		PerMinute: float64(util.GetEnvInt("RATE_LIMIT_AUTH_PER_MINUTE", 5, app)),
+		Burst:     int(util.GetEnvInt("RATE_LIMIT_AUTH_BURST", 10, app)),
+	}
+}
+
+// NewRateLimitStore returns the store selected by RATE_LIMIT_STORE, either
+// "memory" (the default) or "postgres".
+func NewRateLimitStore(app *app.Application) RateLimitStore {
+	if util.GetEnv("RATE_LIMIT_STORE", app) == "postgres" {
+		return NewPostgresRateLimitStore(app)
+	}
+	return NewMemoryRateLimitStore()
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTakeToken(t *testing.T) {
+	// One token a second, up to 5
+	limit := RateLimit{Name: "test", PerMinute: 60, Burst: 5}
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+		allowed bool
+	}{
+		{"full bucket", 5, 0, 4, true},
+		{"last token", 1, 0, 0, true},
+		{"empty bucket", 0, 0, 0, false},
+		{"partly refilled", 0, 500 * time.Millisecond, 0.5, false},
+		{"refilled one token", 0, time.Second, 0, true},
+		{"refilled several tokens", 1, 3 * time.Second, 3, true},
+		{"refill stops at burst", 2, time.Hour, 4, true},
+		{"burst caps a bucket over it", 8, 0, 4, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, allowed := takeToken(limit, tt.tokens, start, start.Add(tt.elapsed))
+			if allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v", allowed, tt.allowed)
+			}
+			if math.Abs(tokens-tt.want) > 1e-9 {
+				t.Errorf("tokens = %v, want %v", tokens, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitResult(t *testing.T) {
+	limit := RateLimit{Name: "test", PerMinute: 60, Burst: 5}
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		reset      time.Duration
+	}{
+		{"allowed", 3, true, 3, 0, 2 * time.Second},
+		{"allowed with a fraction left", 2.5, true, 2, 0, 2500 * time.Millisecond},
+		{"denied", 0, false, 0, time.Second, 5 * time.Second},
+		{"denied while refilling", 0.75, false, 0, 250 * time.Millisecond, 4250 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := rateLimitResult(limit, tt.tokens, tt.allowed)
+			if result.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v", result.Allowed, tt.allowed)
+			}
+			if result.Remaining != tt.remaining {
+				t.Errorf("Remaining = %d, want %d", result.Remaining, tt.remaining)
+			}
+			if result.RetryAfter != tt.retryAfter {
+				t.Errorf("RetryAfter = %v, want %v", result.RetryAfter, tt.retryAfter)
+			}
+			if result.Reset != tt.reset {
+				t.Errorf("Reset = %v, want %v", result.Reset, tt.reset)
+			}
+		})
+	}
+}
+
+// takeBurst takes one token past the burst of limit from the store, checking
+// that exactly the burst is allowed.
+func takeBurst(t *testing.T, store RateLimitStore, limit RateLimit, key string) {
+	t.Helper()
+	for i := range limit.Burst {
+		result, err := store.Take(limit, key)
+		if err != nil {
+			t.Fatalf("take %d: %v", i+1, err)
+		}
+		if !result.Allowed {
+			t.Fatalf("take %d was denied within a burst of %d", i+1, limit.Burst)
+		}
+		if result.Remaining != limit.Burst-i-1 {
+			t.Errorf("take %d: Remaining = %d, want %d", i+1, result.Remaining, limit.Burst-i-1)
+		}
+	}
+
+	result, err := store.Take(limit, key)
+	if err != nil {
+		t.Fatalf("take past the burst: %v", err)
+	}
+	if result.Allowed {
+		t.Fatal("take past the burst was allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Duration(60/limit.PerMinute*float64(time.Second)) {
+		t.Errorf("RetryAfter = %v, want at most one token's refill time", result.RetryAfter)
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	// Slow enough that no token comes back during the test
+	limit := RateLimit{Name: "test", PerMinute: 1, Burst: 3}
+	store := NewMemoryRateLimitStore()
+
+	takeBurst(t, store, limit, "ip:192.0.2.1")
+
+	result, err := store.Take(limit, "ip:192.0.2.2")
+	if err != nil || !result.Allowed {
+		t.Errorf("another key was limited too: %+v, %v", result, err)
+	}
+
+	other := RateLimit{Name: "other", PerMinute: 1, Burst: 3}
+	result, err = store.Take(other, "ip:192.0.2.1")
+	if err != nil || !result.Allowed {
+		t.Errorf("another limit was used up too: %+v, %v", result, err)
+	}
+}
+
+func TestPostgresRateLimitStore(t *testing.T) {
+	testApp := testDB(t)
+	limit := RateLimit{Name: fmt.Sprintf("test-%d", time.Now().UnixNano()), PerMinute: 1, Burst: 3}
+	t.Cleanup(func() {
+		testApp.DB.Exec(`DELETE FROM rate_limit_bucket WHERE key LIKE $1`, limit.Name+":%")
+	})
+	store := NewPostgresRateLimitStore(testApp)
+
+	t.Run("burst", func(t *testing.T) {
+		takeBurst(t, store, limit, "ip:192.0.2.1")
+	})
+
+	t.Run("concurrent takes share the bucket", func(t *testing.T) {
+		const takes = 10
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		allowed := 0
+		for range takes {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := store.Take(limit, "ip:192.0.2.2")
+				if err != nil {
+					t.Errorf("take: %v", err)
+					return
+				}
+				if result.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if allowed != limit.Burst {
+			t.Errorf("%d of %d concurrent takes were allowed, want %d", allowed, takes, limit.Burst)
+		}
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		key := "ip:192.0.2.3"
+		takeBurst(t, store, limit, key)
+
+		// Age the bucket by a minute, which gives back one token
+		_, err := testApp.DB.Exec(`UPDATE rate_limit_bucket SET updated_at = updated_at - interval '1 minute' WHERE key = $1`, limit.Name+":"+key)
+		if err != nil {
+			t.Fatalf("age bucket: %v", err)
+		}
+
+		result, err := store.Take(limit, key)
+		if err != nil || !result.Allowed {
+			t.Fatalf("take after a refill: %+v, %v", result, err)
+		}
+		result, err = store.Take(limit, key)
+		if err != nil || result.Allowed {
+			t.Errorf("second take after a one token refill: %+v, %v", result, err)
+		}
+	})
+}
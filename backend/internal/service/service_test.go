@@ -0,0 +1,52 @@
+package service
+
+import (
+	"database/sql"
+	"gabrielsy/imgnow/internal/app"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestApp() *app.Application {
+	return &app.Application{Logger: log.New(io.Discard, "", 0)}
+}
+
+// withEnv runs the test with vars set, from a directory with a .env file,
+// as settings are only read once one is found. The variables are set
+// directly since loading .env never overrides them, so they do not leak into
+// other tests.
+func withEnv(t *testing.T, vars map[string]string) {
+	t.Helper()
+	for key, value := range vars {
+		t.Setenv(key, value)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), nil, 0o600); err != nil {
+		t.Fatalf("write .env: %v", err)
+	}
+	t.Chdir(dir)
+}
+
+// testDB opens the database named by IMGNOW_TEST_DATABASE_URL, which must
+// have the migrations applied, or skips the test.
+func testDB(t *testing.T) *app.Application {
+	t.Helper()
+	dsn := os.Getenv("IMGNOW_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("IMGNOW_TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatalf("connect to database: %v", err)
+	}
+	testApp := newTestApp()
+	testApp.DB = db
+	return testApp
+}
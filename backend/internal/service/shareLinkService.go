@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gabrielsy/imgnow/internal/app"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"time"
+)
+
+var (
+	ErrShareLinkNotFound = errors.New("share link not found")
+	ErrShareLinkInactive = errors.New("share link is revoked, expired or has reached its view limit")
+)
+
+// shareLinkPurpose is signed into share tokens so they are never taken for
+// another kind of signed token.
+const shareLinkPurpose = "share_link"
+
+type shareLinkPayload struct {
+	LinkId int `json:"l"`
+	FileId int `json:"f"`
+}
+
+type ShareLinkService struct {
+	app *app.Application
+}
+
+func NewShareLinkService(app *app.Application) *ShareLinkService {
+	return &ShareLinkService{app: app}
+}
+
+func (ss *ShareLinkService) Create(file *types.File, request types.CreateShareLinkRequest) (*types.ShareLink, error) {
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		return nil, fmt.Errorf("expiresAt must be in the future")
+	}
+
+	link := &types.ShareLink{
+		FileId:    file.Id,
+		Label:     request.Label,
+		MaxViews:  request.MaxViews,
+		ExpiresAt: request.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if request.Password != nil && *request.Password != "" {
+		hashedPassword, err := util.HashPassword(request.Password)
+		if err != nil {
+			return nil, err
+		}
+		link.Password = hashedPassword
+	}
+
+	err := fileRepo.CreateShareLink(ss.app, link)
+	if err != nil {
+		util.LogError(err, "Failed to create share link", ss.app)
+		return nil, err
+	}
+	return link, nil
+}
+
+func (ss *ShareLinkService) List(file *types.File) ([]*types.ShareLink, error) {
+	links, err := fileRepo.ListShareLinks(ss.app, file.Id)
+	if err != nil {
+		util.LogError(err, "Failed to list share links", ss.app)
+		return nil, err
+	}
+	return links, nil
+}
+
+func (ss *ShareLinkService) Revoke(file *types.File, id int) error {
+	revoked, err := fileRepo.RevokeShareLink(ss.app, file.Id, id)
+	if err != nil {
+		util.LogError(err, "Failed to revoke share link", ss.app)
+		return err
+	}
+	if !revoked {
+		return ErrShareLinkNotFound
+	}
+	return nil
+}
+
+// Token returns the public token of a link. It is derived from the link id,
+// so the same token can be shown again without being stored.
+func (ss *ShareLinkService) Token(link *types.ShareLink) (string, error) {
+	return util.SignToken(shareLinkPurpose, shareLinkPayload{LinkId: link.Id, FileId: link.FileId}, SigningSecret(ss.app))
+}
+
+// Resolve verifies a share token and returns its link and file, failing with
+// ErrShareLinkInactive when the link can no longer be used.
+func (ss *ShareLinkService) Resolve(token string) (*types.ShareLink, *types.File, error) {
+	var payload shareLinkPayload
+	if err := util.VerifyToken(token, shareLinkPurpose, SigningSecret(ss.app), &payload); err != nil {
+		return nil, nil, ErrShareLinkNotFound
+	}
+
+	link, err := fileRepo.FindShareLink(ss.app, payload.LinkId)
+	if err != nil {
+		util.LogError(err, "Failed to find share link", ss.app)
+		return nil, nil, err
+	}
+	if link == nil || link.FileId != payload.FileId {
+		return nil, nil, ErrShareLinkNotFound
+	}
+	if !IsShareLinkActive(link) {
+		return nil, nil, ErrShareLinkInactive
+	}
+
+	file, err := fileRepo.FindFileById(ss.app, link.FileId)
+	if err != nil {
+		util.LogError(err, "Failed to find shared file", ss.app)
+		return nil, nil, err
+	}
+	if file == nil {
+		return nil, nil, ErrShareLinkNotFound
+	}
+	return link, file, nil
+}
+
+// ConsumeView counts a view on the link, failing with ErrShareLinkInactive if
+// another viewer used up the link in the meantime.
+func (ss *ShareLinkService) ConsumeView(link *types.ShareLink) error {
+	allowed, err := fileRepo.ConsumeShareLinkView(ss.app, link.Id)
+	if err != nil {
+		util.LogError(err, "Failed to count share link view", ss.app)
+		return err
+	}
+	if !allowed {
+		return ErrShareLinkInactive
+	}
+	return nil
+}
+
+func IsShareLinkActive(link *types.ShareLink) bool {
+	if link.RevokedAt != nil {
+		return false
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return false
+	}
+	return link.MaxViews == nil || link.Views < *link.MaxViews
+}
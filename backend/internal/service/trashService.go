@@ -0,0 +1,135 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"gabrielsy/imgnow/internal/app"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"time"
+)
+
+var (
+	ErrAlreadyTrashed = errors.New("file is already in the trash")
+	ErrNotRestorable  = errors.New("file is not in the trash or its restore window has passed")
+)
+
+// Default number of hours a trashed file can be restored, overridable with
+// TRASH_RESTORE_HOURS
+const defaultRestoreWindow = 72
+
+// Default number of days deleted files keep their metadata before it is
+// anonymized, overridable with DELETED_RETENTION_DAYS
+const defaultDeletedRetention = 30
+
+type TrashService struct {
+	app *app.Application
+}
+
+func NewTrashService(app *app.Application) *TrashService {
+	return &TrashService{app: app}
+}
+
+func (ts *TrashService) RestoreWindow() time.Duration {
+	return time.Duration(util.GetEnvInt("TRASH_RESTORE_HOURS", defaultRestoreWindow, ts.app)) * time.Hour
+}
+
+// NewManagementToken returns a token for an anonymous upload together with
+// the hash stored on the file.
+func NewManagementToken() (string, string, error) {
+	token, err := util.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, util.HashToken(token), nil
+}
+
+// CheckManagementToken reports whether token is the file's management token.
+func CheckManagementToken(file *types.File, token string) bool {
+	if token == "" || file.ManagementTokenHash == nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(util.HashToken(token)), []byte(*file.ManagementTokenHash)) == 1
+}
+
+// Trash hides the file until it is restored or the restore window passes.
+// Its storage is kept in the meantime.
+func (ts *TrashService) Trash(customUrl string) (time.Time, error) {
+	trashed, err := fileRepo.TrashFile(ts.app, customUrl)
+	if err != nil {
+		util.LogError(err, "Failed to trash file", ts.app)
+		return time.Time{}, err
+	}
+	if !trashed {
+		return time.Time{}, ErrAlreadyTrashed
+	}
+
+	restorableUntil := time.Now().Add(ts.RestoreWindow())
+	NewWebhookService(ts.app).EmitFor(customUrl, types.WebhookFileDeleted, map[string]any{
+		"reason":          "trashed",
+		"restorableUntil": restorableUntil,
+	})
+	return restorableUntil, nil
+}
+
+func (ts *TrashService) Restore(customUrl string) error {
+	restored, err := fileRepo.RestoreFile(ts.app, customUrl, time.Now().Add(-ts.RestoreWindow()))
+	if err != nil {
+		util.LogError(err, "Failed to restore file", ts.app)
+		return err
+	}
+	if !restored {
+		return ErrNotRestorable
+	}
+	return nil
+}
+
+// PurgeTrash permanently removes the storage of files whose restore window
+// has passed and marks them deleted, returning how many were removed.
+func (ts *TrashService) PurgeTrash() (int, error) {
+	files, err := fileRepo.GetTrashedFiles(ts.app, time.Now().Add(-ts.RestoreWindow()))
+	if err != nil {
+		return 0, err
+	}
+
+	fileService := NewFileService(ts.app)
+	purged := 0
+	for _, file := range files {
+		fileService.deleteObjects(file.CustomUrl)
+		if err := fileRepo.ScrubFile(ts.app, file.CustomUrl); err != nil {
+			util.LogError(err, "Failed to scrub purged file", ts.app)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (ts *TrashService) DeletedRetention() time.Duration {
+	return time.Duration(util.GetEnvInt("DELETED_RETENTION_DAYS", defaultDeletedRetention, ts.app)) * 24 * time.Hour
+}
+
+// PurgeDeleted anonymizes files deleted longer than the retention period,
+// returning how many were purged. Storage is deleted again first in case an
+// earlier removal failed. Setting RELEASE_PURGED_URLS to true frees their
+// customUrls for reuse.
+func (ts *TrashService) PurgeDeleted() (int, error) {
+	files, err := fileRepo.GetFilesToPurge(ts.app, time.Now().Add(-ts.DeletedRetention()))
+	if err != nil {
+		return 0, err
+	}
+
+	releaseUrls := util.GetEnv("RELEASE_PURGED_URLS", ts.app) == "true"
+	fileService := NewFileService(ts.app)
+	purged := 0
+	for _, file := range files {
+		fileService.deleteObjects(file.CustomUrl)
+		if err := fileRepo.PurgeFile(ts.app, file.Id, releaseUrls); err != nil {
+			util.LogError(err, "Failed to purge deleted file", ts.app)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"errors"
+	"gabrielsy/imgnow/internal/app"
+	"gabrielsy/imgnow/internal/repository"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	userRepo "gabrielsy/imgnow/internal/repository/user"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrEmailTaken         = errors.New("email is already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrPasswordTooLong    = errors.New("password must be at most 72 bytes")
+)
+
+// maxPasswordBytes is the most bcrypt hashes. Credentials are validated in
+// characters, so multi-byte passwords are checked again here.
+const maxPasswordBytes = 72
+
+// dummyPasswordHash is compared against when a login names an unknown email,
+// so it takes as long as a wrong password and does not reveal which emails
+// are registered.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	password, err := util.GenerateToken()
+	if err == nil {
+		var hash *string
+		if hash, err = util.HashPassword(&password); err == nil {
+			return *hash
+		}
+	}
+	return ""
+})
+
+type UserService struct {
+	app *app.Application
+}
+
+func NewUserService(app *app.Application) *UserService {
+	return &UserService{app: app}
+}
+
+func (us *UserService) SessionTTL() time.Duration {
+	return time.Duration(util.GetEnvInt("SESSION_TTL_HOURS", 24*30, us.app)) * time.Hour
+}
+
+func (us *UserService) Register(credentials types.Credentials) (*types.User, error) {
+	email := strings.ToLower(strings.TrimSpace(credentials.Email))
+	if len(credentials.Password) > maxPasswordBytes {
+		return nil, ErrPasswordTooLong
+	}
+
+	existing, err := userRepo.FindUserByEmail(us.app, email)
+	if err != nil {
+		util.LogError(err, "Failed to look up user", us.app)
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrEmailTaken
+	}
+
+	hashedPassword, err := util.HashPassword(&credentials.Password)
+	if err != nil {
+		util.LogError(err, "Failed to hash password", us.app)
+		return nil, err
+	}
+
+	user := &types.User{
+		Email:     email,
+		Password:  *hashedPassword,
+		CreatedAt: time.Now(),
+	}
+	err = userRepo.CreateUser(us.app, user)
+	// The lookup above is only a fast path, a concurrent registration of the
+	// same email is caught by the unique constraint
+	if repository.IsUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	if err != nil {
+		util.LogError(err, "Failed to create user", us.app)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Login checks the credentials and opens a new session, returning the
+// session token to hand to the client.
+func (us *UserService) Login(credentials types.Credentials) (*types.User, string, error) {
+	email := strings.ToLower(strings.TrimSpace(credentials.Email))
+
+	user, err := userRepo.FindUserByEmail(us.app, email)
+	if err != nil {
+		util.LogError(err, "Failed to look up user", us.app)
+		return nil, "", err
+	}
+	if user == nil {
+		util.CheckPasswordHash(credentials.Password, dummyPasswordHash())
+		return nil, "", ErrInvalidCredentials
+	}
+	if !util.CheckPasswordHash(credentials.Password, user.Password) {
+		return nil, "", ErrInvalidCredentials
+	}
+
+	token, err := util.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	err = userRepo.CreateSession(us.app, &types.Session{
+		TokenHash: util.HashToken(token),
+		UserId:    user.Id,
+		CreatedAt: now,
+		ExpiresAt: now.Add(us.SessionTTL()),
+	})
+	if err != nil {
+		util.LogError(err, "Failed to create session", us.app)
+		return nil, "", err
+	}
+
+	return user, token, nil
+}
+
+func (us *UserService) Logout(token string) error {
+	return userRepo.DeleteSession(us.app, util.HashToken(token))
+}
+
+// Authenticate resolves a session token to its user, or nil when the token is
+// unknown or expired.
+func (us *UserService) Authenticate(token string) (*types.User, error) {
+	return userRepo.FindUserBySession(us.app, util.HashToken(token))
+}
+
+func (us *UserService) ListFiles(user *types.User, filter types.FileFilter) ([]*types.File, int, error) {
+	files, total, err := fileRepo.ListFilesByOwner(us.app, user.Id, filter)
+	if err != nil {
+		util.LogError(err, "Failed to list user files", us.app)
+		return nil, 0, err
+	}
+	return files, total, nil
+}
+
+// OwnedFiles returns the files among customUrls that belong to the user,
+// silently skipping unknown or foreign ones.
+func (us *UserService) OwnedFiles(user *types.User, customUrls []string) ([]*types.File, error) {
+	var owned []*types.File
+	for _, customUrl := range customUrls {
+		file, err := fileRepo.FindFileByCustomUrl(us.app, customUrl)
+		if err != nil {
+			return nil, err
+		}
+		if file != nil && file.OwnerId != nil && *file.OwnerId == user.Id && file.DeletedAt == nil {
+			owned = append(owned, file)
+		}
+	}
+	return owned, nil
+}
@@ -1,7 +1,6 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,7 +8,6 @@ import (
 	"gabrielsy/imgnow/internal/types"
 	"gabrielsy/imgnow/internal/util"
 	"io"
-	"mime/multipart"
 	"path/filepath"
 	"time"
 
@@ -31,53 +29,182 @@ func NewVideoService(app *app.Application) *VideoService {
 	amqpChannel, err := amqpConn.Channel()
 	if err != nil {
 		util.LogError(err, "Failed to open a channel", app)
+		amqpConn.Close()
 		return nil
 	}
 	return &VideoService{app: app, amqpConn: amqpConn, amqpChannel: amqpChannel}
 }
 
-func (vs *VideoService) HandleVideoCompression(file *multipart.FileHeader) (io.Reader, int64, error) {
-	src, err := file.Open()
+func (vs *VideoService) Close() {
+	vs.amqpChannel.Close()
+	vs.amqpConn.Close()
+}
+
+// compressedVideoType is the type of every video the media worker stores.
+const compressedVideoType = "video/mp4"
+
+// mediaProcessingTimeout bounds how long an upload waits for the media
+// worker, queueing included.
+const mediaProcessingTimeout = 5 * time.Minute
+
+// mediaURLTTL is how long the URLs presigned for the media worker stay
+// valid. It outlives the whole wait, so a job that spent most of it queued
+// still finds its URLs valid while it runs.
+const mediaURLTTL = 2 * mediaProcessingTimeout
+
+// processingPrefix holds the uploads staged for the media worker. Custom URLs
+// cannot contain a slash, so staged keys never clash with a file.
+const processingPrefix = "processing/"
+
+// Bounds on the output presigned for the media worker. Transcoding rarely
+// grows an upload, the margin covers low bitrate sources, and parts grow
+// rather than the message once the output would need more of them.
+const (
+	outputSizeFactor = 4
+	maxOutputParts   = 1000
+)
+
+// processingJob is an upload staged for the media worker, along with the
+// multipart upload the worker stores its output into.
+type processingJob struct {
+	app       *app.Application
+	r2        *R2Service
+	sourceKey string
+	sourceURL string
+	outputKey string
+	uploadId  string
+	partSize  int64
+	partURLs  []string
+	completed bool
+}
+
+// stageForProcessing streams the upload to R2 under a staging key, starts
+// the multipart upload of outputKey and presigns the URLs the media worker
+// reads the upload from and writes the output parts to, so the media never
+// travels through RabbitMQ. The caller completes the job with the parts the
+// worker sent, and closes it once the worker is done.
+func stageForProcessing(app *app.Application, src io.Reader, contentType string, requestID string, outputKey string, outputType string) (*processingJob, error) {
+	r2 := NewR2Service(app)
+	job := &processingJob{app: app, r2: r2, sourceKey: processingPrefix + requestID, outputKey: outputKey}
+	sourceSize, err := r2.UploadStreamToR2(src, contentType, job.sourceKey)
 	if err != nil {
-		return nil, 0, err
+		util.LogError(err, "Failed to stage upload for processing", app)
+		return nil, fmt.Errorf("failed to stage upload: %w", err)
 	}
-	defer src.Close()
 
-	fileBytes, err := io.ReadAll(src)
+	job.uploadId, err = r2.StartMultipartUpload(outputKey, outputType)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to read file: %w", err)
+		job.Close()
+		util.LogError(err, "Failed to start output upload", app)
+		return nil, err
+	}
+
+	if err := job.presign(sourceSize); err != nil {
+		job.Close()
+		util.LogError(err, "Failed to presign processing URLs", app)
+		return nil, fmt.Errorf("failed to presign processing URLs: %w", err)
+	}
+	return job, nil
+}
+
+func (job *processingJob) presign(sourceSize int64) error {
+	var err error
+	if job.sourceURL, err = job.r2.GetFromR2WithExpiry(job.sourceKey, mediaURLTTL); err != nil {
+		return err
+	}
+
+	outputSize := outputSizeFactor*sourceSize + 1
+	job.partSize = max(job.r2.PartSize(), (outputSize+maxOutputParts-1)/maxOutputParts)
+	parts := (outputSize + job.partSize - 1) / job.partSize
+	job.partURLs = make([]string, 0, parts)
+	for partNumber := int32(1); int64(partNumber) <= parts; partNumber++ {
+		partURL, err := job.r2.PresignUploadPart(job.outputKey, job.uploadId, partNumber, mediaURLTTL)
+		if err != nil {
+			return err
+		}
+		job.partURLs = append(job.partURLs, partURL)
+	}
+	return nil
+}
+
+// Complete stores the output from the parts the worker uploaded.
+func (job *processingJob) Complete(parts []types.MediaPart) error {
+	if len(parts) == 0 {
+		return fmt.Errorf("media worker uploaded no output")
+	}
+	uploaded := make([]UploadedPart, 0, len(parts))
+	for _, part := range parts {
+		uploaded = append(uploaded, UploadedPart{PartNumber: part.PartNumber, ETag: part.ETag})
 	}
 
+	if err := job.r2.CompleteMultipartUpload(job.outputKey, job.uploadId, uploaded); err != nil {
+		util.LogError(err, "Failed to complete output upload", job.app)
+		return err
+	}
+	job.completed = true
+	return nil
+}
+
+// Close removes the staged upload, and aborts the output upload unless it
+// was completed.
+func (job *processingJob) Close() {
+	err := job.r2.DeleteFromR2(job.sourceKey)
+	util.LogError(err, "Failed to delete staged upload", job.app)
+	if job.uploadId != "" && !job.completed {
+		err = job.r2.AbortMultipartUpload(job.outputKey, job.uploadId)
+		util.LogError(err, "Failed to abort output upload", job.app)
+	}
+}
+
+// HandleVideoCompression has the media worker compress the upload and store
+// the result at customUrl, returning its size.
+func (vs *VideoService) HandleVideoCompression(src io.Reader, originalName string, contentType string, customUrl string) (int64, error) {
 	requestID := util.GenerateHash()
-	filename := requestID + filepath.Ext(file.Filename)
+	job, err := stageForProcessing(vs.app, src, contentType, requestID, customUrl, compressedVideoType)
+	if err != nil {
+		return 0, err
+	}
+	defer job.Close()
+
 	message := types.VideoMessage{
-		Filename:  filename,
-		Content:   fileBytes,
-		RequestID: requestID,
+		Filename:       requestID + filepath.Ext(originalName),
+		RequestID:      requestID,
+		SourceKey:      job.sourceKey,
+		SourceURL:      job.sourceURL,
+		OutputKey:      customUrl,
+		OutputPartURLs: job.partURLs,
+		PartSize:       job.partSize,
 	}
 
 	// Setup response queue with unique name
 	responseQueue, err := vs.setupResponseQueue(requestID)
 	if err != nil {
-		return nil, 0, err
+		return 0, err
 	}
 
 	// Setup consumer
 	msgs, err := vs.setupQueueConsumer(responseQueue.Name)
 	if err != nil {
-		return nil, 0, err
+		return 0, err
 	}
 
 	// Publish video for compression
 	if err := vs.publishVideoForCompression(message); err != nil {
-		return nil, 0, err
+		return 0, err
 	}
 
 	// Wait for response with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), mediaProcessingTimeout)
 	defer cancel()
 
-	return vs.waitForCompressedVideo(ctx, msgs, requestID)
+	response, err := vs.waitForCompressedVideo(ctx, msgs, requestID)
+	if err != nil {
+		return 0, err
+	}
+	if err := job.Complete(response.OutputParts); err != nil {
+		return 0, err
+	}
+	return response.Size, nil
 }
 
 func (vs *VideoService) setupResponseQueue(requestID string) (*amqp.Queue, error) {
@@ -133,22 +260,22 @@ func (vs *VideoService) publishVideoForCompression(message types.VideoMessage) e
 	)
 }
 
-func (vs *VideoService) waitForCompressedVideo(ctx context.Context, msgs <-chan amqp.Delivery, requestID string) (io.Reader, int64, error) {
+func (vs *VideoService) waitForCompressedVideo(ctx context.Context, msgs <-chan amqp.Delivery, requestID string) (*types.VideoMessage, error) {
 	for {
 		select {
 		case msg := <-msgs:
 			var response types.VideoMessage
 			if err := json.Unmarshal(msg.Body, &response); err != nil {
 				util.LogError(err, "Failed to unmarshal response", vs.app)
-				return nil, 0, fmt.Errorf("failed to unmarshal response: %w", err)
+				return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 			}
 
 			if response.RequestID == requestID {
-				return bytes.NewReader(response.Content), int64(len(response.Content)), nil
+				return &response, nil
 			}
 		case <-ctx.Done():
 			util.LogError(nil, "Timeout waiting for video compression response", vs.app)
-			return nil, 0, fmt.Errorf("timeout waiting for video compression response")
+			return nil, fmt.Errorf("timeout waiting for video compression response")
 		}
 	}
 }
@@ -0,0 +1,558 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gabrielsy/imgnow/internal/app"
+	fileRepo "gabrielsy/imgnow/internal/repository/file"
+	userRepo "gabrielsy/imgnow/internal/repository/user"
+	"gabrielsy/imgnow/internal/types"
+	"gabrielsy/imgnow/internal/util"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// WebhookSecretPrefix marks webhook signing secrets.
+const WebhookSecretPrefix = "whsec_"
+
+// Default webhook delivery settings, overridable with WEBHOOK_MAX_ATTEMPTS,
+// WEBHOOK_TIMEOUT_SECONDS and WEBHOOK_DELIVERY_RETENTION_DAYS
+const (
+	defaultWebhookMaxAttempts = 6
+	defaultWebhookTimeout     = 10
+	defaultWebhookRetention   = 30
+)
+
+const (
+	// First retry delay, doubled on every further failure
+	webhookRetryBase = 30 * time.Second
+	// Deliveries retried by a single run of the retry job
+	webhookRetryBatch = 20
+	// Bytes of the endpoint's response kept in the delivery log
+	maxWebhookResponseBody = 1024
+	maxWebhooksPerUser     = 20
+	maxWebhookDeliveries   = 100
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrInvalidWebhook   = errors.New("invalid webhook")
+	ErrAddressForbidden = errors.New("webhook address is not public")
+)
+
+// webhookPayload is the JSON body of every delivery. Id is the same across
+// retries so endpoints can ignore duplicates.
+type webhookPayload struct {
+	Id        string             `json:"id"`
+	Event     types.WebhookEvent `json:"event"`
+	CreatedAt time.Time          `json:"createdAt"`
+	Data      map[string]any     `json:"data"`
+}
+
+type WebhookService struct {
+	app *app.Application
+}
+
+func NewWebhookService(app *app.Application) *WebhookService {
+	return &WebhookService{app: app}
+}
+
+func (ws *WebhookService) MaxAttempts() int {
+	return int(util.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts, ws.app))
+}
+
+func (ws *WebhookService) Timeout() time.Duration {
+	return time.Duration(util.GetEnvInt("WEBHOOK_TIMEOUT_SECONDS", defaultWebhookTimeout, ws.app)) * time.Second
+}
+
+func (ws *WebhookService) DeliveryRetention() time.Duration {
+	return time.Duration(util.GetEnvInt("WEBHOOK_DELIVERY_RETENTION_DAYS", defaultWebhookRetention, ws.app)) * 24 * time.Hour
+}
+
+// lease is how long a delivery being sent is hidden from the retry job. It
+// outlasts the request timeout so a delivery is never sent twice at once.
+func (ws *WebhookService) lease() time.Duration {
+	return ws.Timeout() + time.Minute
+}
+
+// CreateWebhook registers an endpoint for the user with a new signing
+// secret.
+func (ws *WebhookService) CreateWebhook(user *types.User, request types.CreateWebhookRequest) (*types.Webhook, error) {
+	if err := validateWebhook(request.Url, request.Events); err != nil {
+		return nil, err
+	}
+
+	webhooks, err := userRepo.ListWebhooks(ws.app, user.Id)
+	if err != nil {
+		util.LogError(err, "Failed to list webhooks", ws.app)
+		return nil, err
+	}
+	if len(webhooks) >= maxWebhooksPerUser {
+		return nil, fmt.Errorf("%w: at most %d webhooks are allowed", ErrInvalidWebhook, maxWebhooksPerUser)
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	webhook := &types.Webhook{
+		UserId:    user.Id,
+		Url:       request.Url,
+		Secret:    secret,
+		Events:    slices.Compact(slices.Sorted(slices.Values(request.Events))),
+		Active:    true,
+		CreatedAt: time.Now(),
+	}
+	err = userRepo.CreateWebhook(ws.app, webhook)
+	if err != nil {
+		util.LogError(err, "Failed to create webhook", ws.app)
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (ws *WebhookService) ListWebhooks(user *types.User) ([]*types.Webhook, error) {
+	webhooks, err := userRepo.ListWebhooks(ws.app, user.Id)
+	if err != nil {
+		util.LogError(err, "Failed to list webhooks", ws.app)
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+func (ws *WebhookService) findWebhook(user *types.User, id int) (*types.Webhook, error) {
+	webhook, err := userRepo.FindWebhook(ws.app, user.Id, id)
+	if err != nil {
+		util.LogError(err, "Failed to find webhook", ws.app)
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (ws *WebhookService) UpdateWebhook(user *types.User, id int, request types.UpdateWebhookRequest) (*types.Webhook, error) {
+	webhook, err := ws.findWebhook(user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Url != nil {
+		webhook.Url = *request.Url
+	}
+	if request.Events != nil {
+		webhook.Events = slices.Compact(slices.Sorted(slices.Values(request.Events)))
+	}
+	if request.Active != nil {
+		webhook.Active = *request.Active
+	}
+	if err := validateWebhook(webhook.Url, webhook.Events); err != nil {
+		return nil, err
+	}
+	if request.RotateSecret {
+		if webhook.Secret, err = newWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	err = userRepo.UpdateWebhook(ws.app, webhook)
+	if err != nil {
+		util.LogError(err, "Failed to update webhook", ws.app)
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (ws *WebhookService) DeleteWebhook(user *types.User, id int) error {
+	deleted, err := userRepo.DeleteWebhook(ws.app, user.Id, id)
+	if err != nil {
+		util.LogError(err, "Failed to delete webhook", ws.app)
+		return err
+	}
+	if !deleted {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// Deliveries returns the latest deliveries of one of the user's webhooks.
+func (ws *WebhookService) Deliveries(user *types.User, id int, limit int) ([]*types.WebhookDelivery, error) {
+	if _, err := ws.findWebhook(user, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxWebhookDeliveries {
+		limit = maxWebhookDeliveries
+	}
+
+	deliveries, err := userRepo.ListWebhookDeliveries(ws.app, id, limit)
+	if err != nil {
+		util.LogError(err, "Failed to list webhook deliveries", ws.app)
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Test sends a webhook.test event to the endpoint straight away, whether or
+// not the webhook is active, and returns the logged delivery. Test events
+// are not retried.
+func (ws *WebhookService) Test(user *types.User, id int) (*types.WebhookDelivery, error) {
+	webhook, err := ws.findWebhook(user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := newWebhookPayload(types.WebhookTest, map[string]any{
+		"webhook": map[string]any{"id": webhook.Id, "url": webhook.Url},
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := ws.queue(webhook, types.WebhookTest, payload)
+	if err != nil {
+		return nil, err
+	}
+	ws.attempt(webhook, delivery, false)
+	return delivery, nil
+}
+
+// Emit notifies the file owner's webhooks subscribed to event, in the
+// background. data is merged into the payload next to the file. Files
+// without an owner have no webhooks.
+func (ws *WebhookService) Emit(file *types.File, event types.WebhookEvent, data map[string]any) {
+	if file == nil || file.OwnerId == nil {
+		return
+	}
+	go ws.emit(file, event, data)
+}
+
+// EmitFor is Emit for callers that only know the file's customUrl. The file
+// is loaded in the background, so the payload shows it after the change.
+func (ws *WebhookService) EmitFor(customUrl string, event types.WebhookEvent, data map[string]any) {
+	go func() {
+		file, err := fileRepo.FindFileByCustomUrl(ws.app, customUrl)
+		if err != nil {
+			util.LogError(err, "Failed to find file for webhook", ws.app)
+			return
+		}
+		if file == nil || file.OwnerId == nil {
+			return
+		}
+		ws.emit(file, event, data)
+	}()
+}
+
+func (ws *WebhookService) emit(file *types.File, event types.WebhookEvent, data map[string]any) {
+	webhooks, err := userRepo.ListWebhooks(ws.app, *file.OwnerId)
+	if err != nil {
+		util.LogError(err, "Failed to list webhooks", ws.app)
+		return
+	}
+	webhooks = slices.DeleteFunc(webhooks, func(webhook *types.Webhook) bool {
+		return !webhook.Active || !slices.Contains(webhook.Events, event)
+	})
+	if len(webhooks) == 0 {
+		return
+	}
+
+	fields := map[string]any{"file": ws.webhookFile(file)}
+	for key, value := range data {
+		fields[key] = value
+	}
+	payload, err := newWebhookPayload(event, fields)
+	if err != nil {
+		util.LogError(err, "Failed to encode webhook payload", ws.app)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		delivery, err := ws.queue(webhook, event, payload)
+		if err != nil {
+			continue
+		}
+		go ws.attempt(webhook, delivery, true)
+	}
+}
+
+// queue logs a delivery before its first attempt, leased so the retry job
+// leaves it alone until that attempt is over.
+func (ws *WebhookService) queue(webhook *types.Webhook, event types.WebhookEvent, payload string) (*types.WebhookDelivery, error) {
+	now := time.Now()
+	leaseUntil := now.Add(ws.lease())
+	delivery := &types.WebhookDelivery{
+		WebhookId:     webhook.Id,
+		Event:         event,
+		Payload:       payload,
+		Status:        types.DeliveryPending,
+		NextAttemptAt: &leaseUntil,
+		CreatedAt:     now,
+	}
+	err := userRepo.CreateWebhookDelivery(ws.app, delivery)
+	if err != nil {
+		util.LogError(err, "Failed to log webhook delivery", ws.app)
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// RetryDue sends the pending deliveries whose next attempt is due, a batch
+// at a time, and returns how many were attempted.
+func (ws *WebhookService) RetryDue() (int, error) {
+	attempted := 0
+	for {
+		deliveries, err := userRepo.ClaimDueWebhookDeliveries(ws.app, webhookRetryBatch, time.Now().Add(ws.lease()))
+		if err != nil {
+			return attempted, err
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			webhook, err := userRepo.FindWebhookById(ws.app, delivery.WebhookId)
+			if err != nil {
+				util.LogError(err, "Failed to find webhook", ws.app)
+				continue
+			}
+			if webhook == nil {
+				continue
+			}
+			if !webhook.Active {
+				message := "webhook is inactive"
+				delivery.Status = types.DeliveryFailed
+				delivery.NextAttemptAt = nil
+				delivery.Error = &message
+				err = userRepo.UpdateWebhookDelivery(ws.app, delivery)
+				util.LogError(err, "Failed to update webhook delivery", ws.app)
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ws.attempt(webhook, delivery, true)
+			}()
+		}
+		wg.Wait()
+
+		attempted += len(deliveries)
+		if len(deliveries) < webhookRetryBatch {
+			return attempted, nil
+		}
+	}
+}
+
+func (ws *WebhookService) DeleteOldDeliveries() error {
+	return userRepo.DeleteWebhookDeliveriesBefore(ws.app, time.Now().Add(-ws.DeliveryRetention()))
+}
+
+// attempt sends the delivery once and logs the outcome. Failures are
+// retried with exponential backoff while retry is set and attempts remain.
+func (ws *WebhookService) attempt(webhook *types.Webhook, delivery *types.WebhookDelivery, retry bool) {
+	delivery.Attempts++
+	delivery.ResponseStatus = nil
+	delivery.ResponseBody = nil
+	delivery.Error = nil
+
+	status, body, err := ws.send(webhook, delivery)
+	if status != 0 {
+		delivery.ResponseStatus = &status
+		delivery.ResponseBody = &body
+	}
+	if err == nil && (status < 200 || status > 299) {
+		err = fmt.Errorf("endpoint responded with status %d", status)
+	}
+
+	now := time.Now()
+	switch {
+	case err == nil:
+		delivery.Status = types.DeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	case retry && delivery.Attempts < ws.MaxAttempts():
+		next := now.Add(webhookRetryBase << (delivery.Attempts - 1))
+		delivery.Status = types.DeliveryPending
+		delivery.NextAttemptAt = &next
+	default:
+		delivery.Status = types.DeliveryFailed
+		delivery.NextAttemptAt = nil
+	}
+	if err != nil {
+		message := err.Error()
+		delivery.Error = &message
+	}
+
+	err = userRepo.UpdateWebhookDelivery(ws.app, delivery)
+	util.LogError(err, "Failed to update webhook delivery", ws.app)
+}
+
+// send posts the payload to the endpoint, returning its status and the
+// start of its response body.
+func (ws *WebhookService) send(webhook *types.Webhook, delivery *types.WebhookDelivery) (int, string, error) {
+	request, err := http.NewRequest(http.MethodPost, webhook.Url, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "imgnow-webhooks")
+	request.Header.Set("X-Imgnow-Event", string(delivery.Event))
+	request.Header.Set("X-Imgnow-Delivery", strconv.FormatInt(delivery.Id, 10))
+	request.Header.Set("X-Imgnow-Signature", "t="+strconv.FormatInt(timestamp, 10)+",v1="+SignWebhookPayload(webhook.Secret, timestamp, []byte(delivery.Payload)))
+
+	response, err := ws.client().Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, maxWebhookResponseBody))
+	// Postgres text rejects invalid UTF-8 and NUL bytes
+	text := strings.ReplaceAll(strings.ToValidUTF8(string(body), ""), "\x00", "")
+	return response.StatusCode, text, nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+// with the webhook's secret, as sent in the v1 part of X-Imgnow-Signature.
+// Endpoints recompute it to verify a delivery and reject stale timestamps
+// to prevent replays.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	webhookClient     *http.Client
+	webhookClientOnce sync.Once
+)
+
+// client is shared by all deliveries. Redirects are not followed, and
+// unless WEBHOOK_ALLOW_PRIVATE_URLS is true it refuses to connect to
+// loopback, private and link-local addresses, whatever the URL's host
+// resolves to.
+func (ws *WebhookService) client() *http.Client {
+	webhookClientOnce.Do(func() {
+		allowPrivate := util.GetEnv("WEBHOOK_ALLOW_PRIVATE_URLS", ws.app) == "true"
+		dialer := &net.Dialer{
+			Timeout: ws.Timeout(),
+			Control: func(network string, address string, conn syscall.RawConn) error {
+				if allowPrivate {
+					return nil
+				}
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return fmt.Errorf("%w: %s", ErrAddressForbidden, host)
+				}
+				return nil
+			},
+		}
+		webhookClient = &http.Client{
+			Timeout: ws.Timeout(),
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, address)
+				},
+				TLSHandshakeTimeout: ws.Timeout(),
+				MaxIdleConnsPerHost: 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	})
+	return webhookClient
+}
+
+// sharedAddressSpace is the carrier-grade NAT range, not covered by
+// net.IP.IsPrivate.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+func validateWebhook(rawUrl string, events []types.WebhookEvent) error {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("%w: url must not contain credentials", ErrInvalidWebhook)
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("%w: at least one event is required", ErrInvalidWebhook)
+	}
+	for _, event := range events {
+		if !slices.Contains(types.AllWebhookEvents, event) {
+			return fmt.Errorf("%w: unknown event: %s", ErrInvalidWebhook, event)
+		}
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	token, err := util.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	return WebhookSecretPrefix + token, nil
+}
+
+func newWebhookPayload(event types.WebhookEvent, data map[string]any) (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	err := json.NewEncoder(&buffer).Encode(webhookPayload{
+		Id:        "evt_" + hex.EncodeToString(id),
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	return strings.TrimSuffix(buffer.String(), "\n"), err
+}
+
+// webhookFile is the file as shown in payloads. Secrets like its password
+// or management token are left out.
+func (ws *WebhookService) webhookFile(file *types.File) map[string]any {
+	fields := map[string]any{
+		"customUrl": file.CustomUrl,
+		"name":      file.OriginalName,
+		"type":      file.Type,
+		"size":      file.Size,
+		"status":    file.Status,
+		"createdAt": file.CreatedAt,
+		"expiresAt": file.ExpiresIn,
+		"views":     file.Vizualizations,
+		"downloads": file.Downloads,
+		"trashedAt": file.TrashedAt,
+		"deletedAt": file.DeletedAt,
+	}
+	if publicUrl := util.GetEnv("PUBLIC_URL", ws.app); publicUrl != "" {
+		fields["url"] = strings.TrimSuffix(publicUrl, "/") + "/i/" + url.PathEscape(file.CustomUrl)
+	}
+	return fields
+}
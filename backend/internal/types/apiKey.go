@@ -0,0 +1,44 @@
+package types
+
+import (
+	"slices"
+	"time"
+)
+
+type APIKeyScope string
+
+const (
+	ScopeUpload APIKeyScope = "upload"
+	ScopeRead   APIKeyScope = "read"
+	ScopeManage APIKeyScope = "manage"
+)
+
+var AllScopes = []APIKeyScope{ScopeUpload, ScopeRead, ScopeManage}
+
+type APIKey struct {
+	Id         int
+	UserId     int
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []APIKeyScope
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// HasScope reports whether the key grants scope. Keys created without scopes
+// have full access.
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	return len(k.Scopes) == 0 || slices.Contains(k.Scopes, scope)
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string        `json:"name" binding:"required,max=255"`
+	Scopes []APIKeyScope `json:"scopes"`
+}
+
+// ShareXConfigRequest names the API key created for a ShareX uploader.
+type ShareXConfigRequest struct {
+	Name string `json:"name" binding:"max=255"`
+}
@@ -8,12 +8,51 @@ const (
 	Pending FileStatus = "pending"
 	Active  FileStatus = "active"
 	Error   FileStatus = "error"
+	Deleted FileStatus = "deleted"
 )
 
+// VideoMessage asks the media worker to compress the upload staged at
+// SourceKey into OutputKey, and is echoed back with the stored Size. The
+// worker has no R2 credentials, so it reads the upload through the presigned
+// SourceURL and writes the output in PartSize parts through the presigned
+// OutputPartURLs, one per part number in order. The reply lists the
+// OutputParts it sent so the upload can be completed.
 type VideoMessage struct {
-	Filename  string `json:"filename"`
-	Content   []byte `json:"content"`
-	RequestID string `json:"request_id"`
+	Filename       string      `json:"filename"`
+	RequestID      string      `json:"request_id"`
+	SourceKey      string      `json:"source_key"`
+	SourceURL      string      `json:"source_url,omitempty"`
+	OutputKey      string      `json:"output_key"`
+	OutputPartURLs []string    `json:"output_part_urls,omitempty"`
+	PartSize       int64       `json:"part_size,omitempty"`
+	OutputParts    []MediaPart `json:"output_parts,omitempty"`
+	Size           int64       `json:"size,omitempty"`
+}
+
+// AudioMessage is VideoMessage for audio transcoding. The reply also carries
+// the content type the worker chose, the duration, the waveform image and
+// its peaks, which are small.
+type AudioMessage struct {
+	Filename       string      `json:"filename"`
+	RequestID      string      `json:"request_id"`
+	SourceKey      string      `json:"source_key"`
+	SourceURL      string      `json:"source_url,omitempty"`
+	OutputKey      string      `json:"output_key"`
+	OutputPartURLs []string    `json:"output_part_urls,omitempty"`
+	PartSize       int64       `json:"part_size,omitempty"`
+	OutputParts    []MediaPart `json:"output_parts,omitempty"`
+	ContentType    string      `json:"content_type,omitempty"`
+	Size           int64       `json:"size,omitempty"`
+	Duration       float64     `json:"duration,omitempty"`
+	Waveform       []byte      `json:"waveform,omitempty"`
+	Peaks          []float64   `json:"peaks,omitempty"`
+}
+
+// MediaPart is a part of the media worker output, identified by the ETag R2
+// returned when the worker uploaded it.
+type MediaPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
 }
 
 type File struct {
@@ -34,14 +73,40 @@ type File struct {
 	VizualizationsForDeletion  *int
 	LastVizualization          *time.Time
 	ExpiresIn                  *time.Time
-	Password 									 *string
+	Password                   *string
+	Duration                   *float64
+	OwnerId                    *int
+	Uploader                   *string
+	ExpiresAfterViewSeconds    *int
+	TrashedAt                  *time.Time
+	ManagementTokenHash        *string
+	UniqueVizualizations       int
+	CountUniqueViews           bool
+	Width                      *int
+	Height                     *int
 }
 
 type FileSettings struct {
 	ExpiresIn                  *time.Time `json:"expiresIn"`
+	ExpiresAfter               *string    `json:"expiresAfter"`          // e.g. "1h", "1d" or "7d" from upload
+	ExpiresAfterFirstView      *string    `json:"expiresAfterFirstView"` // e.g. "24h" after the first view
+	BurnAfterReading           bool       `json:"burnAfterReading"`      // shorthand for a single allowed view
+	CountUniqueViews           *bool      `json:"countUniqueViews"`      // view limits count unique viewers
 	DeletesAfterDownload       bool       `json:"deletesAfterDownload"`
 	DownloadsForDeletion       *int       `json:"downloadsForDeletion"`
 	DeletesAfterVizualizations bool       `json:"deletesAfterVizualizations"`
 	VizualizationsForDeletion  *int       `json:"vizualizationsForDeletion"`
 	Password                   *string    `json:"password"`
 }
+
+// QuotaUsage is an uploader's standing against the storage and daily upload
+// quotas. A zero limit means unlimited.
+type QuotaUsage struct {
+	BytesUsed  int64
+	BytesLimit int64
+	FilesToday int
+	FilesLimit int
+	// Set when the daily file quota is exhausted, the time until the oldest
+	// upload of the window ages out
+	RetryAfter time.Duration
+}
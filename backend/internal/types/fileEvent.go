@@ -0,0 +1,60 @@
+package types
+
+import "time"
+
+type FileEventKind string
+
+const (
+	EventView     FileEventKind = "view"
+	EventDownload FileEventKind = "download"
+)
+
+type ClientClass string
+
+const (
+	ClientBrowser ClientClass = "browser"
+	ClientMobile  ClientClass = "mobile"
+	ClientBot     ClientClass = "bot"
+	ClientCLI     ClientClass = "cli"
+	ClientOther   ClientClass = "other"
+)
+
+type FileEvent struct {
+	Id           int64
+	FileId       int
+	Kind         FileEventKind
+	ShareLinkId  *int
+	ReferrerHost *string
+	ClientClass  ClientClass
+	Country      *string
+	CreatedAt    time.Time
+}
+
+// Viewer describes the request behind a view or download, before it is
+// reduced to the fields stored on a FileEvent.
+type Viewer struct {
+	IP        string
+	UserAgent string
+	Referrer  string
+}
+
+type StatsBucket struct {
+	Start     time.Time `json:"start"`
+	Views     int       `json:"views"`
+	Downloads int       `json:"downloads"`
+}
+
+type StatsCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type FileStats struct {
+	Interval  string        `json:"interval"`
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Series    []StatsBucket `json:"series"`
+	Countries []StatsCount  `json:"countries"`
+	Referrers []StatsCount  `json:"referrers"`
+	Clients   []StatsCount  `json:"clients"`
+}
@@ -0,0 +1,32 @@
+package types
+
+import "time"
+
+type PasswordAttempt struct {
+	Id        int
+	FileId    int
+	IP        string
+	UserAgent *string
+	CreatedAt time.Time
+	ClearedAt *time.Time
+}
+
+// PasswordFailureStats counts the uncleared failures inside the attempt
+// window for a file, for an IP across all files, and for the pair.
+type PasswordFailureStats struct {
+	FileFailures    int
+	LastFileFailure *time.Time
+	IPFailures      int
+	LastIPFailure   *time.Time
+	PairFailures    int
+	LastPairFailure *time.Time
+}
+
+// PasswordGate is the outcome of checking whether a password attempt may be
+// made right now. An allowed attempt is already recorded as AttemptId.
+type PasswordGate struct {
+	Allowed    bool
+	AttemptId  int
+	Locked     bool
+	RetryAfter time.Duration
+}
@@ -0,0 +1,23 @@
+package types
+
+import "time"
+
+type ShareLink struct {
+	Id           int
+	FileId       int
+	Label        *string
+	Password     *string
+	MaxViews     *int
+	Views        int
+	ExpiresAt    *time.Time
+	CreatedAt    time.Time
+	LastViewedAt *time.Time
+	RevokedAt    *time.Time
+}
+
+type CreateShareLinkRequest struct {
+	Label     *string    `json:"label" binding:"omitempty,max=255"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	MaxViews  *int       `json:"maxViews" binding:"omitempty,min=1"`
+	Password  *string    `json:"password"`
+}
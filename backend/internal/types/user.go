@@ -0,0 +1,37 @@
+package types
+
+import "time"
+
+type User struct {
+	Id        int
+	Email     string
+	Password  string
+	CreatedAt time.Time
+}
+
+type Session struct {
+	TokenHash string
+	UserId    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type Credentials struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8,max=72"` // bcrypt reads at most 72 bytes
+}
+
+type FileFilter struct {
+	Type          string
+	Status        FileStatus
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Trashed       bool
+	Page          int
+	PageSize      int
+}
+
+type BulkFileRequest struct {
+	CustomUrls []string      `json:"customUrls" binding:"required,min=1"`
+	Settings   *FileSettings `json:"settings"`
+}
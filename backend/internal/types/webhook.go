@@ -0,0 +1,74 @@
+package types
+
+import "time"
+
+type WebhookEvent string
+
+const (
+	WebhookUploadCompleted WebhookEvent = "upload.completed"
+	WebhookUploadFailed    WebhookEvent = "upload.failed"
+	WebhookFileViewed      WebhookEvent = "file.viewed"
+	WebhookFileDownloaded  WebhookEvent = "file.downloaded"
+	WebhookFileExpired     WebhookEvent = "file.expired"
+	WebhookFileDeleted     WebhookEvent = "file.deleted"
+
+	// WebhookTest is only sent by the test-fire endpoint, whatever the
+	// webhook subscribes to
+	WebhookTest WebhookEvent = "webhook.test"
+)
+
+var AllWebhookEvents = []WebhookEvent{
+	WebhookUploadCompleted,
+	WebhookUploadFailed,
+	WebhookFileViewed,
+	WebhookFileDownloaded,
+	WebhookFileExpired,
+	WebhookFileDeleted,
+}
+
+type Webhook struct {
+	Id        int
+	UserId    int
+	Url       string
+	Secret    string
+	Events    []WebhookEvent
+	Active    bool
+	CreatedAt time.Time
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+type WebhookDelivery struct {
+	Id             int64
+	WebhookId      int
+	Event          WebhookEvent
+	Payload        string
+	Status         WebhookDeliveryStatus
+	Attempts       int
+	NextAttemptAt  *time.Time
+	ResponseStatus *int
+	ResponseBody   *string
+	Error          *string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+type CreateWebhookRequest struct {
+	Url    string         `json:"url" binding:"required,url,max=2048"`
+	Events []WebhookEvent `json:"events" binding:"required,min=1"`
+}
+
+// UpdateWebhookRequest changes only the fields that are set. RotateSecret
+// replaces the signing secret, returned once in the response.
+type UpdateWebhookRequest struct {
+	Url          *string        `json:"url" binding:"omitempty,url,max=2048"`
+	Events       []WebhookEvent `json:"events" binding:"omitempty,min=1"`
+	Active       *bool          `json:"active"`
+	RotateSecret bool           `json:"rotateSecret"`
+}
@@ -0,0 +1,51 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationUnits = map[byte]time.Duration{
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ParseRetention parses a positive retention period written as a number and
+// a unit: m (minutes), h (hours), d (days) or w (weeks), e.g. "1h" or "7d".
+func ParseRetention(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	unit, ok := durationUnits[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q, expected a unit of m, h, d or w", value)
+	}
+	amount, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || amount <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	return time.Duration(amount) * unit, nil
+}
+
+// ParseDate parses an RFC 3339 timestamp or a plain YYYY-MM-DD date,
+// returning nil for an empty value.
+func ParseDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return &parsed, nil
+	}
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetention(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"30m", 30 * time.Minute, false},
+		{"1h", time.Hour, false},
+		{"1d", 24 * time.Hour, false},
+		{"7d", 7 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{" 7d ", 7 * 24 * time.Hour, false},
+		{"", 0, true},
+		{"d", 0, true},
+		{"7", 0, true},
+		{"7s", 0, true},
+		{"7D", 0, true},
+		{"0d", 0, true},
+		{"-1d", 0, true},
+		{"1.5h", 0, true},
+		{"1h30m", 0, true},
+		{"seven d", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseRetention(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRetention(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package util
 import (
 	"gabrielsy/imgnow/internal/app"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -15,3 +16,18 @@ func GetEnv(key string, app *app.Application) string {
 	}
 	return os.Getenv(key)
 }
+
+// GetEnvInt reads an integer setting, returning fallback when it is unset or
+// not a valid number.
+func GetEnvInt(key string, fallback int64, app *app.Application) int64 {
+	value := GetEnv(key, app)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		LogError(err, "Invalid integer value for "+key, app)
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,55 @@
+package util
+
+import (
+	"mime"
+	"strings"
+)
+
+// Preferred extensions for the types uploads are stored as, since
+// mime.ExtensionsByType lists alternatives in no useful order.
+var typeExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/svg+xml":   ".svg",
+	"image/avif":      ".avif",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"video/quicktime": ".mov",
+	"audio/ogg":       ".ogg",
+	"audio/mp4":       ".m4a",
+	"audio/mpeg":      ".mp3",
+	"audio/wav":       ".wav",
+}
+
+// ExtensionForType returns the file extension, with its dot, for a content
+// type, or "" when none is known.
+func ExtensionForType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if ext, ok := typeExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// AttachmentDisposition builds a Content-Disposition header that downloads
+// the file under name, encoding names that are not plain ASCII.
+func AttachmentDisposition(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "download"
+	}
+	return mime.FormatMediaType("attachment", map[string]string{"filename": name})
+}
@@ -0,0 +1,57 @@
+package util
+
+import (
+	"mime"
+	"strings"
+)
+
+// imageTypes are the image types accepted for upload. SVG can carry
+// scripts, so it is left out of inlineTypes and only ever served as an
+// attachment.
+var imageTypes = map[string]bool{
+	"image/jpeg":    true,
+	"image/png":     true,
+	"image/gif":     true,
+	"image/webp":    true,
+	"image/avif":    true,
+	"image/svg+xml": true,
+}
+
+// inlineTypes are the media types the browser may render rather than
+// download. Any audio or video is accepted for upload, since the media
+// worker transcodes whatever FFmpeg can read, but only these are inline.
+var inlineTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/avif":      true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"video/quicktime": true,
+	"audio/ogg":       true,
+	"audio/mp4":       true,
+	"audio/mpeg":      true,
+	"audio/wav":       true,
+}
+
+// UploadMediaType returns the bare media type of an upload's content type,
+// without parameters, and whether it is accepted.
+func UploadMediaType(contentType string) (string, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+	if strings.HasPrefix(mediaType, "audio/") || strings.HasPrefix(mediaType, "video/") {
+		return mediaType, true
+	}
+	_, ok := imageTypes[mediaType]
+	return mediaType, ok
+}
+
+// InlineMediaType reports whether content of the type may be rendered by
+// the browser rather than downloaded.
+func InlineMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && inlineTypes[mediaType]
+}
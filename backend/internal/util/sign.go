@@ -0,0 +1,68 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// signedToken is what a token carries. The purpose is signed along with the
+// payload, so a token issued for one use is never accepted for another.
+type signedToken struct {
+	Purpose string          `json:"t"`
+	Payload json.RawMessage `json:"d"`
+}
+
+// SignToken encodes payload as JSON together with the purpose of the token
+// and appends its HMAC-SHA256, so the token can be checked later without
+// keeping any server-side state.
+func SignToken(purpose string, payload any, secret []byte) (string, error) {
+	encodedPayload, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(signedToken{Purpose: purpose, Payload: encodedPayload})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + sign(encoded, secret), nil
+}
+
+// Fingerprint returns a keyed hash of the values, identifying a client
+// without keeping what identifies it.
+func Fingerprint(secret []byte, values ...string) string {
+	return sign(strings.Join(values, "\x00"), secret)
+}
+
+// VerifyToken checks the signature and the purpose of a SignToken token and
+// decodes its payload into dest.
+func VerifyToken(token string, purpose string, secret []byte, dest any) error {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(sign(encoded, secret))) {
+		return ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	var signed signedToken
+	if err := json.Unmarshal(data, &signed); err != nil || signed.Purpose != purpose {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(signed.Payload, dest); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func sign(encoded string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,67 @@
+package util
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testPayload struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestSignToken(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	token, err := SignToken("test", testPayload{Id: 7, Name: "cat.png"}, secret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	encoded, signature, _ := strings.Cut(token, ".")
+
+	// Re-signs a token whose payload JSON was changed, as only someone
+	// holding the secret could
+	resign := func(data string) string {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(data))
+		return encoded + "." + sign(encoded, secret)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		purpose string
+		secret  []byte
+		wantErr bool
+	}{
+		{"valid", token, "test", secret, false},
+		{"other purpose", token, "other", secret, true},
+		{"other secret", token, "test", []byte("another secret of the same length"), true},
+		{"tampered payload", base64.RawURLEncoding.EncodeToString([]byte(`{"t":"test","d":{"id":8,"name":"cat.png"}}`)) + "." + signature, "test", secret, true},
+		{"tampered signature", encoded + "." + strings.Repeat("A", len(signature)), "test", secret, true},
+		{"signature only", "." + signature, "test", secret, true},
+		{"no signature", encoded, "test", secret, true},
+		{"empty", "", "test", secret, true},
+		{"payload that is not JSON", resign("not json"), "test", secret, true},
+		{"payload without purpose", resign(`{"id":7,"name":"cat.png"}`), "test", secret, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var payload testPayload
+			err := VerifyToken(tt.token, tt.purpose, tt.secret, &payload)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("err = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if payload != (testPayload{Id: 7, Name: "cat.png"}) {
+				t.Errorf("payload = %+v", payload)
+			}
+		})
+	}
+}
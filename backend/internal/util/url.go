@@ -0,0 +1,32 @@
+package util
+
+import (
+	"gabrielsy/imgnow/internal/app"
+	"net/http"
+	"strings"
+)
+
+// APIPrefix is where the current version of the API is served.
+const APIPrefix = "/api/v1"
+
+// PublicURL returns the absolute URL the API is reached at, from PUBLIC_URL
+// or, when unset, from the request itself.
+func PublicURL(r *http.Request, app *app.Application) string {
+	if publicUrl := GetEnv("PUBLIC_URL", app); publicUrl != "" {
+		return strings.TrimSuffix(publicUrl, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// FrontendURL returns the absolute URL of the web app, from FRONTEND_URL.
+func FrontendURL(app *app.Application) string {
+	if frontendUrl := GetEnv("FRONTEND_URL", app); frontendUrl != "" {
+		return strings.TrimSuffix(frontendUrl, "/")
+	}
+	return "http://localhost:4200"
+}
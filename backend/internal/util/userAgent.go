@@ -0,0 +1,64 @@
+package util
+
+import (
+	"gabrielsy/imgnow/internal/types"
+	"net/url"
+	"strings"
+)
+
+// Substrings of the user agents of crawlers and link-preview fetchers
+var botAgents = []string{
+	"bot", "crawler", "spider", "slurp", "preview", "facebookexternalhit",
+	"embedly", "whatsapp", "skypeuripreview", "bitlybot", "vkshare", "redditbot",
+	"headlesschrome", "lighthouse", "pingdom", "uptimerobot",
+}
+
+var cliAgents = []string{
+	"curl", "wget", "httpie", "python-requests", "go-http-client", "okhttp", "imgnow-cli",
+}
+
+var mobileAgents = []string{"mobile", "android", "iphone", "ipad"}
+
+func IsBot(userAgent string) bool {
+	return containsAny(strings.ToLower(userAgent), botAgents)
+}
+
+// ClassifyClient reduces a user agent to a coarse class, so no fingerprint
+// of the viewer is kept.
+func ClassifyClient(userAgent string) types.ClientClass {
+	agent := strings.ToLower(userAgent)
+	switch {
+	case agent == "":
+		return types.ClientOther
+	case containsAny(agent, botAgents):
+		return types.ClientBot
+	case containsAny(agent, cliAgents):
+		return types.ClientCLI
+	case containsAny(agent, mobileAgents):
+		return types.ClientMobile
+	case strings.HasPrefix(agent, "mozilla/"):
+		return types.ClientBrowser
+	default:
+		return types.ClientOther
+	}
+}
+
+// ReferrerHost returns the host of a Referer header, or nil when it is
+// missing or not a URL.
+func ReferrerHost(referrer string) *string {
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Hostname() == "" {
+		return nil
+	}
+	host := strings.ToLower(parsed.Hostname())
+	return &host
+}
+
+func containsAny(value string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(value, substring) {
+			return true
+		}
+	}
+	return false
+}
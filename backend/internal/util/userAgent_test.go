@@ -0,0 +1,56 @@
+package util
+
+import (
+	"gabrielsy/imgnow/internal/types"
+	"testing"
+)
+
+func TestClassifyClient(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      types.ClientClass
+	}{
+		{"Chrome on Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36", types.ClientBrowser},
+		{"Firefox on Linux", "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0", types.ClientBrowser},
+		{"Safari on macOS", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Safari/605.1.15", types.ClientBrowser},
+		{"Edge on Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.2478.51", types.ClientBrowser},
+		{"Safari on iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4.1 Mobile/15E148 Safari/604.1", types.ClientMobile},
+		{"Chrome on Android", "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.82 Mobile Safari/537.36", types.ClientMobile},
+		{"Safari on iPad", "Mozilla/5.0 (iPad; CPU OS 16_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1", types.ClientMobile},
+		{"Googlebot", "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", types.ClientBot},
+		{"Googlebot smartphone", "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.6367.118 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", types.ClientBot},
+		{"Bingbot", "Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko; compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm) Chrome/116.0.1938.76 Safari/537.36", types.ClientBot},
+		{"Discord", "Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)", types.ClientBot},
+		{"Slack", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", types.ClientBot},
+		{"Twitter", "Twitterbot/1.0", types.ClientBot},
+		{"Telegram", "TelegramBot (like TwitterBot)", types.ClientBot},
+		{"Facebook", "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", types.ClientBot},
+		{"iMessage", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_11_1) AppleWebKit/601.2.4 (KHTML, like Gecko) Version/9.0.1 Safari/601.2.4 facebookexternalhit/1.1 Facebot Twitterbot/1.0", types.ClientBot},
+		{"WhatsApp", "WhatsApp/2.23.20.0", types.ClientBot},
+		{"Skype", "Mozilla/5.0 (Windows NT 6.1; WOW64) SkypeUriPreview Preview/0.5 skype-url-preview@microsoft.com", types.ClientBot},
+		{"Headless Chrome", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/124.0.0.0 Safari/537.36", types.ClientBot},
+		{"UptimeRobot", "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", types.ClientBot},
+		{"curl", "curl/8.4.0", types.ClientCLI},
+		{"Wget", "Wget/1.21.4", types.ClientCLI},
+		{"HTTPie", "HTTPie/3.2.2", types.ClientCLI},
+		{"Python requests", "python-requests/2.31.0", types.ClientCLI},
+		{"Go", "Go-http-client/1.1", types.ClientCLI},
+		{"OkHttp", "okhttp/4.12.0", types.ClientCLI},
+		{"imgnow CLI", "imgnow-cli/1.0", types.ClientCLI},
+		{"empty", "", types.ClientOther},
+		{"Java", "Java/17.0.2", types.ClientOther},
+		{"unknown", "SomeApp/1.0", types.ClientOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyClient(tt.userAgent); got != tt.want {
+				t.Errorf("ClassifyClient(%q) = %q, want %q", tt.userAgent, got, tt.want)
+			}
+			if got, want := IsBot(tt.userAgent), tt.want == types.ClientBot; got != want {
+				t.Errorf("IsBot(%q) = %v, want %v", tt.userAgent, got, want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"gabrielsy/imgnow/internal/app"
 	"gabrielsy/imgnow/internal/router"
+	"gabrielsy/imgnow/internal/service"
 	"gabrielsy/imgnow/internal/util"
 	"os"
 )
@@ -14,6 +15,13 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err := service.CheckSigningSecret(app); err != nil {
+		util.LogError(err, "Invalid configuration", app)
+		os.Exit(1)
+	}
+
+	service.StartJobs(app)
+
 	r := router.SetupRoutes(app)
 	r.Run(":8080")
 }
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS file (
+    id                           SERIAL PRIMARY KEY,
+    custom_url                   VARCHAR(255) NOT NULL UNIQUE,
+    path                         TEXT,
+    original_name                TEXT NOT NULL,
+    size                         INTEGER NOT NULL,
+    type                         VARCHAR(255) NOT NULL,
+    created_at                   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    status                       VARCHAR(32) NOT NULL,
+    vizualizations               INTEGER NOT NULL DEFAULT 0,
+    deletes_after_download       BOOLEAN NOT NULL DEFAULT FALSE,
+    deleted_at                   TIMESTAMP,
+    downloads_for_deletion       INTEGER,
+    deletes_after_vizualizations BOOLEAN NOT NULL DEFAULT FALSE,
+    vizualizations_for_deletion  INTEGER,
+    last_vizualization           TIMESTAMP,
+    expires_in                   TIMESTAMP,
+    downloads                    INTEGER NOT NULL DEFAULT 0,
+    password                     TEXT
+);
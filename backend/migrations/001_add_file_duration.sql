@@ -0,0 +1,2 @@
+-- Playback length in seconds for audio uploads, filled in by the transcoder.
+ALTER TABLE file ADD COLUMN IF NOT EXISTS duration DOUBLE PRECISION;
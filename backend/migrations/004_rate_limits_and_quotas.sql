@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS rate_limit_bucket (
+    key        VARCHAR(255) PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Identity the upload counts against for quotas: "user:<id>" or "ip:<addr>".
+ALTER TABLE file ADD COLUMN IF NOT EXISTS uploader VARCHAR(255);
+CREATE INDEX IF NOT EXISTS file_uploader_idx ON file (uploader, created_at);
@@ -0,0 +1,14 @@
+-- Failed password attempts on protected files. Rows are kept as an audit log
+-- for the owner; unlocking a file sets cleared_at so they stop counting
+-- towards delays and lockouts.
+CREATE TABLE IF NOT EXISTS password_attempt (
+    id         SERIAL PRIMARY KEY,
+    file_id    INTEGER NOT NULL REFERENCES file(id) ON DELETE CASCADE,
+    ip         VARCHAR(64) NOT NULL,
+    user_agent TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    cleared_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS password_attempt_file_idx ON password_attempt (file_id, created_at);
+CREATE INDEX IF NOT EXISTS password_attempt_ip_idx ON password_attempt (ip, created_at);
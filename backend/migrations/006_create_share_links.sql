@@ -0,0 +1,16 @@
+-- Additional public identities for a file, each with its own limits. The
+-- link token is an HMAC over the row id, so it is not stored.
+CREATE TABLE IF NOT EXISTS share_link (
+    id             SERIAL PRIMARY KEY,
+    file_id        INTEGER NOT NULL REFERENCES file(id) ON DELETE CASCADE,
+    label          VARCHAR(255),
+    password       TEXT,
+    max_views      INTEGER,
+    views          INTEGER NOT NULL DEFAULT 0,
+    expires_at     TIMESTAMP,
+    created_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_viewed_at TIMESTAMP,
+    revoked_at     TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS share_link_file_id_idx ON share_link (file_id);
@@ -0,0 +1,2 @@
+-- When set, the file expires this many seconds after its first view.
+ALTER TABLE file ADD COLUMN IF NOT EXISTS expires_after_view_seconds INTEGER;
@@ -0,0 +1,8 @@
+-- Files deleted on demand sit in the trash until they are restored or purged.
+ALTER TABLE file ADD COLUMN IF NOT EXISTS trashed_at TIMESTAMP;
+
+-- SHA-256 of the token returned at upload that lets anonymous uploaders
+-- manage their file.
+ALTER TABLE file ADD COLUMN IF NOT EXISTS management_token_hash TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_file_trashed_at ON file (trashed_at) WHERE trashed_at IS NOT NULL AND deleted_at IS NULL;
@@ -0,0 +1,7 @@
+-- Deleted files used to share the error status.
+UPDATE file SET status = 'deleted' WHERE deleted_at IS NOT NULL AND status = 'error';
+
+-- Set once a deleted file's metadata has been anonymized.
+ALTER TABLE file ADD COLUMN IF NOT EXISTS purged_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_file_deleted_at ON file (deleted_at) WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
@@ -0,0 +1,15 @@
+-- Append-only log of views and downloads. Rows are only ever inserted, and
+-- deleted once older than the analytics retention period.
+CREATE TABLE IF NOT EXISTS file_event (
+    id            BIGSERIAL PRIMARY KEY,
+    file_id       INTEGER NOT NULL REFERENCES file(id) ON DELETE CASCADE,
+    kind          VARCHAR(16) NOT NULL,
+    share_link_id INTEGER REFERENCES share_link(id) ON DELETE SET NULL,
+    referrer_host VARCHAR(255),
+    client_class  VARCHAR(16) NOT NULL,
+    country       CHAR(2),
+    created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS file_event_file_idx ON file_event (file_id, created_at);
+CREATE INDEX IF NOT EXISTS file_event_created_at_idx ON file_event (created_at);
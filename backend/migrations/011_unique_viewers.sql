@@ -0,0 +1,16 @@
+ALTER TABLE file ADD COLUMN IF NOT EXISTS unique_vizualizations INTEGER NOT NULL DEFAULT 0;
+
+-- Whether view limits count unique viewers rather than every view.
+ALTER TABLE file ADD COLUMN IF NOT EXISTS count_unique_views BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Viewers seen per file, identified by a keyed hash of their IP and user
+-- agent. A viewer counts as unique again once seen_at is older than the
+-- unique view window.
+CREATE TABLE IF NOT EXISTS file_viewer (
+    file_id     INTEGER NOT NULL REFERENCES file(id) ON DELETE CASCADE,
+    viewer_hash VARCHAR(64) NOT NULL,
+    seen_at     TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (file_id, viewer_hash)
+);
+
+CREATE INDEX IF NOT EXISTS file_viewer_seen_at_idx ON file_viewer (seen_at);
@@ -0,0 +1,3 @@
+-- Pixel dimensions, known for images processed at upload.
+ALTER TABLE file ADD COLUMN IF NOT EXISTS width INTEGER;
+ALTER TABLE file ADD COLUMN IF NOT EXISTS height INTEGER;
@@ -0,0 +1,8 @@
+-- Set once a file's objects have been removed from storage, so deleted files
+-- whose removal was deferred or failed can be found again.
+ALTER TABLE file ADD COLUMN IF NOT EXISTS storage_deleted_at TIMESTAMP;
+
+-- Deleted files from before this column had their storage removed at once.
+UPDATE file SET storage_deleted_at = deleted_at WHERE deleted_at IS NOT NULL AND storage_deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_file_storage_pending ON file (expires_in) WHERE deleted_at IS NOT NULL AND storage_deleted_at IS NULL;
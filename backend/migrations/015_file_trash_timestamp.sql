@@ -0,0 +1,3 @@
+-- trashed_at was created as TIMESTAMPTZ, unlike the other file timestamps.
+-- A no-op where it already is a TIMESTAMP.
+ALTER TABLE file ALTER COLUMN trashed_at TYPE TIMESTAMP;
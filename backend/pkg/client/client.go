@@ -0,0 +1,102 @@
+// Package client is a Go client for the imgnow API.
+//
+//	c := client.New("https://imgnow.example", client.WithAPIKey(key))
+//	upload, err := c.Upload(ctx, file, client.UploadOptions{Name: "cat.png"})
+//	if err == nil {
+//		err = c.WaitUntilActive(ctx, upload.CustomUrl, 0)
+//	}
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// apiPrefix is the version of the API the client speaks.
+const apiPrefix = "/api/v1"
+
+// Client calls an imgnow server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+type Option func(*Client)
+
+// WithAPIKey authenticates requests with an API key, needed to list files
+// and to manage files owned by the key's user.
+func WithAPIKey(apiKey string) Option {
+	return func(c *Client) {
+		c.apiKey = apiKey
+	}
+}
+
+// WithHTTPClient sends requests through httpClient instead of
+// http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a client for the server at baseURL, e.g.
+// "https://imgnow.example".
+func New(baseURL string, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// HasAPIKey reports whether requests are authenticated with an API key.
+func (c *Client) HasAPIKey() bool {
+	return c.apiKey != ""
+}
+
+// do sends a request to path and decodes the JSON response into out, which
+// may be nil. Error statuses are returned as an *Error.
+func (c *Client) do(ctx context.Context, method string, path string, header http.Header, body io.Reader, out any) error {
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	request.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return newError(response)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+// filePath is the API path of a file, or of one of its sub resources.
+func filePath(customUrl string, resource string) string {
+	path := apiPrefix + "/file/" + url.PathEscape(customUrl)
+	if resource != "" {
+		path += "/" + resource
+	}
+	return path
+}
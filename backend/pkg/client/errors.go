@@ -0,0 +1,81 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Errors matched by the *Error of the corresponding status, so callers can
+// check errors.Is(err, client.ErrNotFound).
+var (
+	ErrNotFound     = errors.New("not found")                     // 404
+	ErrNotReady     = errors.New("file is still being processed") // 425
+	ErrUnauthorized = errors.New("unauthorized")                  // 401
+	ErrForbidden    = errors.New("forbidden")                     // 403
+	ErrGone         = errors.New("file is no longer available")   // 410
+)
+
+// Error is an error response from the server.
+type Error struct {
+	StatusCode int
+	Code       string // e.g. "not_found", stable across messages
+	Message    string
+	Details    map[string]any // e.g. requiresPassword
+	RequestID  string         // quote it when reporting a problem
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s (%d, request %s)", e.Message, e.StatusCode, e.RequestID)
+	}
+	return fmt.Sprintf("%s (%d)", e.Message, e.StatusCode)
+}
+
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooEarly:
+		return ErrNotReady
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	case http.StatusForbidden:
+		return ErrForbidden
+	case http.StatusGone:
+		return ErrGone
+	}
+	return nil
+}
+
+// newError reads the error body of an error response, falling back to the
+// status text for responses without one.
+func newError(response *http.Response) *Error {
+	var body struct {
+		Error struct {
+			Code      string         `json:"code"`
+			Message   string         `json:"message"`
+			Details   map[string]any `json:"details"`
+			RequestID string         `json:"requestId"`
+		} `json:"error"`
+	}
+	err := &Error{
+		StatusCode: response.StatusCode,
+		Message:    http.StatusText(response.StatusCode),
+		RequestID:  response.Header.Get("X-Request-ID"),
+	}
+	if json.NewDecoder(response.Body).Decode(&body) != nil {
+		return err
+	}
+
+	err.Code = body.Error.Code
+	err.Details = body.Error.Details
+	if body.Error.Message != "" {
+		err.Message = body.Error.Message
+	}
+	if body.Error.RequestID != "" {
+		err.RequestID = body.Error.RequestID
+	}
+	return err
+}
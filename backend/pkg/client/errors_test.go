@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorMapping(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		header     string
+		sentinel   error
+		code       string
+		message    string
+		requestID  string
+		hasDetails bool
+	}{
+		{
+			name:      "not found",
+			status:    http.StatusNotFound,
+			body:      `{"error":{"code":"not_found","message":"File not found","requestId":"req-1"}}`,
+			sentinel:  ErrNotFound,
+			code:      "not_found",
+			message:   "File not found",
+			requestID: "req-1",
+		},
+		{
+			name:     "not ready",
+			status:   http.StatusTooEarly,
+			body:     `{"error":{"code":"too_early","message":"File is still being processed"}}`,
+			sentinel: ErrNotReady,
+			code:     "too_early",
+			message:  "File is still being processed",
+		},
+		{
+			name:     "unauthorized",
+			status:   http.StatusUnauthorized,
+			body:     `{"error":{"code":"unauthorized","message":"Invalid API key"}}`,
+			sentinel: ErrUnauthorized,
+			code:     "unauthorized",
+			message:  "Invalid API key",
+		},
+		{
+			name:       "password required",
+			status:     http.StatusForbidden,
+			body:       `{"error":{"code":"forbidden","message":"Password required","details":{"requiresPassword":true}}}`,
+			sentinel:   ErrForbidden,
+			code:       "forbidden",
+			message:    "Password required",
+			hasDetails: true,
+		},
+		{
+			name:     "gone",
+			status:   http.StatusGone,
+			body:     `{"error":{"code":"gone","message":"File is no longer available"}}`,
+			sentinel: ErrGone,
+			code:     "gone",
+			message:  "File is no longer available",
+		},
+		{
+			name:    "status without a sentinel",
+			status:  http.StatusTooManyRequests,
+			body:    `{"error":{"code":"rate_limited","message":"Too many requests"}}`,
+			code:    "rate_limited",
+			message: "Too many requests",
+		},
+		{
+			name:      "body that is not an envelope",
+			status:    http.StatusBadGateway,
+			body:      `<html>Bad gateway</html>`,
+			header:    "req-2",
+			message:   "Bad Gateway",
+			requestID: "req-2",
+		},
+		{
+			name:      "request id from the header",
+			status:    http.StatusNotFound,
+			body:      `{"error":{"code":"not_found","message":"File not found"}}`,
+			header:    "req-3",
+			sentinel:  ErrNotFound,
+			code:      "not_found",
+			message:   "File not found",
+			requestID: "req-3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("X-Request-ID", tt.header)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := New(server.URL).Info(context.Background(), "cat")
+
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *Error", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.status)
+			}
+			if apiErr.Code != tt.code {
+				t.Errorf("Code = %q, want %q", apiErr.Code, tt.code)
+			}
+			if apiErr.Message != tt.message {
+				t.Errorf("Message = %q, want %q", apiErr.Message, tt.message)
+			}
+			if apiErr.RequestID != tt.requestID {
+				t.Errorf("RequestID = %q, want %q", apiErr.RequestID, tt.requestID)
+			}
+			if tt.hasDetails && apiErr.Details["requiresPassword"] != true {
+				t.Errorf("Details = %v, want requiresPassword", apiErr.Details)
+			}
+
+			for _, sentinel := range []error{ErrNotFound, ErrNotReady, ErrUnauthorized, ErrForbidden, ErrGone} {
+				if got := errors.Is(err, sentinel); got != (sentinel == tt.sentinel) {
+					t.Errorf("errors.Is(err, %v) = %v", sentinel, got)
+				}
+			}
+		})
+	}
+}
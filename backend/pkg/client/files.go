@@ -0,0 +1,292 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// DefaultPollInterval is how often WaitUntilActive checks a pending file
+// when no interval is given.
+const DefaultPollInterval = time.Second
+
+// Upload streams r to the server. The settings are sent ahead of the
+// content, so the file is created with its password and limits in place.
+//
+// Processed uploads like videos come back pending, see WaitUntilActive.
+func (c *Client) Upload(ctx context.Context, r io.Reader, options UploadOptions) (*UploadResult, error) {
+	settings := options.Settings
+	if settings.ExpiresIn != nil && settings.ExpiresAfter != nil {
+		return nil, errors.New("ExpiresIn and ExpiresAfter are mutually exclusive")
+	}
+	if settings.BurnAfterReading && settings.VizualizationsForDeletion != nil && *settings.VizualizationsForDeletion != 1 {
+		return nil, errors.New("BurnAfterReading allows a single view")
+	}
+
+	name := options.Name
+	if name == "" {
+		name = "upload"
+	}
+	total := options.Size
+	if total <= 0 {
+		total = readerSize(r)
+	}
+
+	reader := bufio.NewReader(r)
+	contentType := options.ContentType
+	if contentType == "" {
+		contentType = detectContentType(name, reader)
+	}
+
+	query := url.Values{}
+	if options.CustomUrl != "" {
+		query.Set("customUrl", options.CustomUrl)
+	}
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = reader
+	if options.Progress != nil {
+		src = &progressReader{reader: reader, total: total, progress: options.Progress}
+	}
+
+	// The body is written while it is sent, so large files are never held
+	// in memory
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		err := form.WriteField("settings", string(settingsJSON))
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "file", "filename": name}))
+		header.Set("Content-Type", contentType)
+		part, err := form.CreatePart(header)
+		if err == nil {
+			_, err = io.Copy(part, src)
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	path := apiPrefix + "/file/upload"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var result UploadResult
+	header := http.Header{"Content-Type": {form.FormDataContentType()}}
+	err = c.do(ctx, http.MethodPost, path, header, body, &result)
+	body.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Status returns the processing status of a file.
+func (c *Client) Status(ctx context.Context, customUrl string) (FileStatus, error) {
+	var response struct {
+		Status FileStatus `json:"status"`
+	}
+	err := c.do(ctx, http.MethodGet, filePath(customUrl, "status"), nil, nil, &response)
+	return response.Status, err
+}
+
+// WaitUntilActive polls the status of a file every interval, or
+// DefaultPollInterval when it is 0, until it is active. It fails when
+// processing fails or ctx is done first.
+func (c *Client) WaitUntilActive(ctx context.Context, customUrl string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := c.Status(ctx, customUrl)
+		if err != nil {
+			return err
+		}
+
+		switch status {
+		case StatusActive:
+			return nil
+		case StatusError, StatusDeleted:
+			return fmt.Errorf("processing %s failed: file is %s", customUrl, status)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Info returns a file without counting a view.
+func (c *Client) Info(ctx context.Context, customUrl string) (*File, error) {
+	var file File
+	err := c.do(ctx, http.MethodGet, filePath(customUrl, "info"), nil, nil, &file)
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// View returns a link to view a file, counting a view. password is only
+// needed for protected files and may be empty.
+func (c *Client) View(ctx context.Context, customUrl string, password string) (*View, error) {
+	method := http.MethodGet
+	var header http.Header
+	var body io.Reader
+	if password != "" {
+		payload, err := json.Marshal(map[string]string{"password": password})
+		if err != nil {
+			return nil, err
+		}
+		method = http.MethodPost
+		header = http.Header{"Content-Type": {"application/json"}}
+		body = bytes.NewReader(payload)
+	}
+
+	var view View
+	err := c.do(ctx, method, filePath(customUrl, ""), header, body, &view)
+	if err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// UpdateSettings changes the settings that are set in settings. Files not
+// owned by the API key's user need the managementToken returned on upload,
+// otherwise it may be empty.
+func (c *Client) UpdateSettings(ctx context.Context, customUrl string, managementToken string, settings FileSettings) error {
+	payload, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	header := managementHeader(managementToken)
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+	return c.do(ctx, http.MethodPut, filePath(customUrl, "settings"), header, bytes.NewReader(payload), nil)
+}
+
+// Delete moves a file to the trash, returning until when it can be
+// restored. Files not owned by the API key's user need the managementToken
+// returned on upload, otherwise it may be empty.
+func (c *Client) Delete(ctx context.Context, customUrl string, managementToken string) (time.Time, error) {
+	var response struct {
+		RestorableUntil time.Time `json:"restorableUntil"`
+	}
+	err := c.do(ctx, http.MethodDelete, filePath(customUrl, ""), managementHeader(managementToken), nil, &response)
+	return response.RestorableUntil, err
+}
+
+// Restore takes a file back out of the trash.
+func (c *Client) Restore(ctx context.Context, customUrl string, managementToken string) error {
+	return c.do(ctx, http.MethodPost, filePath(customUrl, "restore"), managementHeader(managementToken), nil, nil)
+}
+
+// List returns a page of the files of the API key's user.
+func (c *Client) List(ctx context.Context, options ListOptions) (*FileList, error) {
+	query := url.Values{}
+	if options.Type != "" {
+		query.Set("type", options.Type)
+	}
+	if options.Status != "" {
+		query.Set("status", string(options.Status))
+	}
+	if options.Trashed {
+		query.Set("trashed", "true")
+	}
+	if options.CreatedAfter != nil {
+		query.Set("from", options.CreatedAfter.Format(time.RFC3339))
+	}
+	if options.CreatedBefore != nil {
+		query.Set("to", options.CreatedBefore.Format(time.RFC3339))
+	}
+	if options.Page > 0 {
+		query.Set("page", strconv.Itoa(options.Page))
+	}
+	if options.PageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(options.PageSize))
+	}
+
+	var list FileList
+	err := c.do(ctx, http.MethodGet, apiPrefix+"/me/files?"+query.Encode(), nil, nil, &list)
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func managementHeader(managementToken string) http.Header {
+	if managementToken == "" {
+		return nil
+	}
+	return http.Header{"X-Management-Token": {managementToken}}
+}
+
+// detectContentType guesses the content type from the file extension, or
+// from the first bytes of the content when the extension is unknown.
+func detectContentType(name string, reader *bufio.Reader) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(name)); contentType != "" {
+		return contentType
+	}
+	head, _ := reader.Peek(512)
+	return http.DetectContentType(head)
+}
+
+// readerSize returns the length of files and in-memory readers, or -1.
+func readerSize(r io.Reader) int64 {
+	switch src := r.(type) {
+	case interface{ Len() int }:
+		return int64(src.Len())
+	case *os.File:
+		if info, err := src.Stat(); err == nil && info.Mode().IsRegular() {
+			return info.Size()
+		}
+	}
+	return -1
+}
+
+// progressReader reports the bytes read through it.
+type progressReader struct {
+	reader   io.Reader
+	sent     int64
+	total    int64
+	progress func(sent int64, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.reader.Read(p)
+	if n > 0 {
+		pr.sent += int64(n)
+		pr.progress(pr.sent, pr.total)
+	}
+	return n, err
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uploadRequest is what the test server saw of an upload.
+type uploadRequest struct {
+	method      string
+	path        string
+	query       string
+	auth        string
+	parts       []string
+	settings    FileSettings
+	filename    string
+	contentType string
+	content     string
+}
+
+// uploadServer records the upload it receives and answers with response.
+func uploadServer(t *testing.T, seen *uploadRequest, response string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen.method = r.Method
+		seen.path = r.URL.Path
+		seen.query = r.URL.RawQuery
+		seen.auth = r.Header.Get("Authorization")
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("read multipart: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("next part: %v", err)
+				return
+			}
+			seen.parts = append(seen.parts, part.FormName())
+			data, _ := io.ReadAll(part)
+			switch part.FormName() {
+			case "settings":
+				if err := json.Unmarshal(data, &seen.settings); err != nil {
+					t.Errorf("parse settings %s: %v", data, err)
+				}
+			case "file":
+				seen.filename = part.FileName()
+				seen.contentType = part.Header.Get("Content-Type")
+				seen.content = string(data)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpload(t *testing.T) {
+	var seen uploadRequest
+	server := uploadServer(t, &seen, `{"status":"pending","customUrl":"my-cat","managementToken":"mt","url":"http://imgnow.test/i/my-cat.png"}`)
+
+	password := "hunter22"
+	views := 3
+	expiresAfter := "7d"
+	var progress []int64
+	result, err := New(server.URL, WithAPIKey("key")).Upload(context.Background(), strings.NewReader("not really a png"), UploadOptions{
+		Name:      "cat.png",
+		CustomUrl: "my-cat",
+		Settings: FileSettings{
+			ExpiresAfter:               &expiresAfter,
+			DeletesAfterVizualizations: true,
+			VizualizationsForDeletion:  &views,
+			Password:                   &password,
+		},
+		Progress: func(sent int64, total int64) {
+			progress = append(progress, sent, total)
+		},
+	})
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	if seen.method != http.MethodPost || seen.path != "/api/v1/file/upload" {
+		t.Errorf("request = %s %s, want POST /api/v1/file/upload", seen.method, seen.path)
+	}
+	if seen.query != "customUrl=my-cat" {
+		t.Errorf("query = %q, want only the custom URL", seen.query)
+	}
+	if seen.auth != "Bearer key" {
+		t.Errorf("Authorization = %q", seen.auth)
+	}
+	if strings.Join(seen.parts, ",") != "settings,file" {
+		t.Errorf("parts = %v, want the settings before the file", seen.parts)
+	}
+	if seen.settings.Password == nil || *seen.settings.Password != password ||
+		seen.settings.ExpiresAfter == nil || *seen.settings.ExpiresAfter != expiresAfter ||
+		!seen.settings.DeletesAfterVizualizations ||
+		seen.settings.VizualizationsForDeletion == nil || *seen.settings.VizualizationsForDeletion != views {
+		t.Errorf("settings = %+v, want those of the upload", seen.settings)
+	}
+	if seen.filename != "cat.png" || seen.contentType != "image/png" || seen.content != "not really a png" {
+		t.Errorf("file = %q %q %q", seen.filename, seen.contentType, seen.content)
+	}
+
+	if result.CustomUrl != "my-cat" || result.Status != StatusPending || result.ManagementToken != "mt" {
+		t.Errorf("result = %+v", result)
+	}
+	if len(progress) < 2 || progress[len(progress)-2] != int64(len("not really a png")) || progress[len(progress)-1] != int64(len("not really a png")) {
+		t.Errorf("progress = %v, want it to end with everything sent", progress)
+	}
+}
+
+func TestUploadRejectsInvalidSettings(t *testing.T) {
+	var seen uploadRequest
+	server := uploadServer(t, &seen, `{}`)
+	expiresIn := time.Now().Add(time.Hour)
+	expiresAfter := "1d"
+	views := 2
+
+	tests := []struct {
+		name     string
+		settings FileSettings
+	}{
+		{"both expiries", FileSettings{ExpiresIn: &expiresIn, ExpiresAfter: &expiresAfter}},
+		{"burn after reading with more views", FileSettings{BurnAfterReading: true, VizualizationsForDeletion: &views}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(server.URL).Upload(context.Background(), strings.NewReader("x"), UploadOptions{Name: "x.txt", Settings: tt.settings})
+			if err == nil {
+				t.Fatal("upload succeeded")
+			}
+			if seen.method != "" {
+				t.Error("invalid settings were sent")
+			}
+		})
+	}
+}
+
+func TestUploadError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":"rate_limited","message":"Daily upload quota exceeded","requestId":"req-1"}}`))
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).Upload(context.Background(), strings.NewReader("x"), UploadOptions{Name: "x.txt"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want an *Error", err)
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Message != "Daily upload quota exceeded" || apiErr.RequestID != "req-1" {
+		t.Errorf("err = %+v", apiErr)
+	}
+}
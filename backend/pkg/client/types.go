@@ -0,0 +1,107 @@
+package client
+
+import "time"
+
+type FileStatus string
+
+const (
+	StatusPending FileStatus = "pending"
+	StatusActive  FileStatus = "active"
+	StatusError   FileStatus = "error"
+	StatusDeleted FileStatus = "deleted"
+)
+
+// File is a file as returned by the info and list endpoints.
+type File struct {
+	CustomUrl                  string     `json:"customUrl"`
+	OriginalName               string     `json:"originalName"`
+	Size                       int        `json:"size"`
+	Type                       string     `json:"type"`
+	CreatedAt                  time.Time  `json:"createdAt"`
+	Status                     FileStatus `json:"status"`
+	ExpiresAt                  *time.Time `json:"expiresAt"`
+	ExpiresAfterFirstView      *int       `json:"expiresAfterFirstView"` // seconds
+	DeletedAt                  *time.Time `json:"deletedAt"`
+	TrashedAt                  *time.Time `json:"trashedAt"`
+	Vizualizations             int        `json:"vizualizations"`
+	UniqueVizualizations       int        `json:"uniqueVizualizations"`
+	CountUniqueViews           bool       `json:"countUniqueViews"`
+	Downloads                  int        `json:"downloads"`
+	DeletesAfterDownload       bool       `json:"deletesAfterDownload"`
+	DownloadsForDeletion       *int       `json:"downloadsForDeletion"`
+	DeletesAfterVizualizations bool       `json:"deletesAfterVizualizations"`
+	VizualizationsForDeletion  *int       `json:"vizualizationsForDeletion"`
+	Duration                   *float64   `json:"duration"`
+}
+
+// FileSettings changes the expiry, limits or password of a file. Unset
+// fields are left as they are.
+type FileSettings struct {
+	ExpiresIn                  *time.Time `json:"expiresIn,omitempty"`
+	ExpiresAfter               *string    `json:"expiresAfter,omitempty"`          // e.g. "1h", "1d" or "7d" from upload
+	ExpiresAfterFirstView      *string    `json:"expiresAfterFirstView,omitempty"` // e.g. "24h" after the first view
+	BurnAfterReading           bool       `json:"burnAfterReading,omitempty"`      // shorthand for a single allowed view
+	CountUniqueViews           *bool      `json:"countUniqueViews,omitempty"`      // view limits count unique viewers
+	DeletesAfterDownload       bool       `json:"deletesAfterDownload,omitempty"`
+	DownloadsForDeletion       *int       `json:"downloadsForDeletion,omitempty"`
+	DeletesAfterVizualizations bool       `json:"deletesAfterVizualizations,omitempty"`
+	VizualizationsForDeletion  *int       `json:"vizualizationsForDeletion,omitempty"`
+	Password                   *string    `json:"password,omitempty"`
+}
+
+// UploadOptions describe an upload.
+type UploadOptions struct {
+	Name        string // file name, also used to detect the content type
+	ContentType string // detected from Name or the content when empty
+	CustomUrl   string // generated when empty
+	Settings    FileSettings
+
+	// Size is the length of the content, used as the total reported to
+	// Progress. It is detected for files and in-memory readers.
+	Size int64
+
+	// Progress is called as the content is sent, with the bytes sent so far
+	// and the total, which is -1 when unknown.
+	Progress func(sent int64, total int64)
+}
+
+// UploadResult is the response to an upload.
+type UploadResult struct {
+	Message         string     `json:"message"`
+	Status          FileStatus `json:"status"`
+	CustomUrl       string     `json:"customUrl"`
+	StatusUrl       string     `json:"statusUrl"`
+	ExpiresAt       *time.Time `json:"expiresAt"`
+	ManagementToken string     `json:"managementToken"` // manages the file without an API key
+	URL             string     `json:"url"`             // the file itself
+	PageURL         string     `json:"pageUrl"`         // share page with link previews
+	ThumbnailURL    string     `json:"thumbnailUrl"`
+	DeletionURL     string     `json:"deletionUrl"`
+}
+
+// View is a link to view a file.
+type View struct {
+	Path                 string     `json:"path"`
+	AccessToken          string     `json:"accessToken,omitempty"` // set when a password was checked
+	AccessTokenExpiresAt *time.Time `json:"accessTokenExpiresAt,omitempty"`
+}
+
+// ListOptions filter the files of the API key's user. Zero values are
+// ignored.
+type ListOptions struct {
+	Type          string // image, video or audio
+	Status        FileStatus
+	Trashed       bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Page          int
+	PageSize      int
+}
+
+// FileList is a page of files.
+type FileList struct {
+	Files    []File `json:"files"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+	Total    int    `json:"total"`
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Sample rate used to decode audio for peak extraction, high enough for a
+// preview and low enough to keep the decoded PCM small.
+const peaksSampleRate = 8000
+
+// AudioMessage is VideoMessage for audio. The reply also carries the
+// content type of the output, the duration, the waveform image and its
+// peaks.
+type AudioMessage struct {
+	Filename       string      `json:"filename"`
+	RequestID      string      `json:"request_id"`
+	SourceKey      string      `json:"source_key"`
+	SourceURL      string      `json:"source_url,omitempty"`
+	OutputKey      string      `json:"output_key"`
+	OutputPartURLs []string    `json:"output_part_urls,omitempty"`
+	PartSize       int64       `json:"part_size,omitempty"`
+	OutputParts    []MediaPart `json:"output_parts,omitempty"`
+	ContentType    string      `json:"content_type,omitempty"`
+	Size           int64       `json:"size,omitempty"`
+	Duration       float64     `json:"duration,omitempty"`
+	Waveform       []byte      `json:"waveform,omitempty"`
+	Peaks          []float64   `json:"peaks,omitempty"`
+}
+
+// Params:
+// id: The ID of the worker
+// l: The logger
+// cfg: The .env configuration
+// ch: The channel owned by this worker, used for acks and replies
+// deliveries: The deliveries
+// ffmpegSlots: Semaphore capping concurrent FFmpeg processes across workers
+func audioWorker(id int, l *logger, cfg Config, ch *amqp.Channel, deliveries <-chan amqp.Delivery, ffmpegSlots chan struct{}) {
+	l.logInfo("Audio worker %d started and waiting for messages", id)
+	for d := range deliveries {
+		l.logInfo("Audio worker %d received an audio file to transcode", id)
+		var audioMsg AudioMessage
+		if err := json.Unmarshal(d.Body, &audioMsg); err != nil {
+			l.logError(err, "Audio worker %d: Error parsing JSON", id)
+			d.Nack(false, false)
+			continue
+		}
+
+		ffmpegSlots <- struct{}{}
+		returnMessage, err := processAudio(audioMsg, cfg)
+		<-ffmpegSlots
+		if err != nil {
+			l.logError(err, "Audio worker %d: Error processing audio", id)
+			d.Nack(false, false)
+			continue
+		}
+
+		l.logInfo("Audio worker %d: Audio transcoded successfully", id)
+
+		returnMessageBytes, err := json.Marshal(returnMessage)
+		if err != nil {
+			l.logError(err, "Audio worker %d: Error marshalling return message", id)
+			d.Nack(false, false)
+			continue
+		}
+
+		reply(id, l, ch, d, returnMessageBytes)
+	}
+}
+
+// processAudio downloads the source, uploads its transcoded version and
+// returns the reply with the previews.
+func processAudio(msg AudioMessage, cfg Config) (*AudioMessage, error) {
+	source, err := fetch(msg.SourceURL)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(source)
+
+	output, err := tempFile()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(output)
+
+	contentType, err := transcodeAudio(source, output, cfg)
+	if err != nil {
+		return nil, err
+	}
+	parts, size, err := store(msg.OutputPartURLs, msg.PartSize, output)
+	if err != nil {
+		return nil, err
+	}
+
+	waveform, err := execFFmpeg(
+		"-i", source,
+		"-filter_complex", fmt.Sprintf("aformat=channel_layouts=mono,showwavespic=s=%s:colors=%s", cfg.WaveformSize, cfg.WaveformColor),
+		"-frames:v", "1",
+		"-c:v", "png",
+		"-f", "image2pipe",
+		"pipe:1",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render waveform: %w", err)
+	}
+
+	peaks, duration, err := extractPeaks(source, cfg.WaveformPeaks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AudioMessage{
+		Filename:    msg.Filename,
+		RequestID:   msg.RequestID,
+		SourceKey:   msg.SourceKey,
+		OutputKey:   msg.OutputKey,
+		OutputParts: parts,
+		ContentType: contentType,
+		Size:        size,
+		Duration:    duration,
+		Waveform:    waveform,
+		Peaks:       peaks,
+	}, nil
+}
+
+// transcodeAudio converts the source file to Opus (Ogg) or AAC (MP4) in the
+// output file depending on AUDIO_FORMAT, normalizing loudness to the
+// configured integrated target. It returns the content type of the output.
+func transcodeAudio(source string, output string, cfg Config) (string, error) {
+	loudnorm := fmt.Sprintf("loudnorm=I=%s:TP=-1.5:LRA=11", cfg.AudioLoudness)
+
+	switch cfg.AudioFormat {
+	case "opus":
+		_, err := execFFmpeg(
+			"-y",
+			"-i", source,
+			"-vn",
+			"-af", loudnorm,
+			"-c:a", "libopus",
+			"-b:a", "96k",
+			"-f", "ogg",
+			output,
+		)
+		return "audio/ogg", err
+	case "aac":
+		_, err := execFFmpeg(
+			"-y",
+			"-i", source,
+			"-vn",
+			"-af", loudnorm,
+			"-c:a", "aac",
+			"-b:a", "128k",
+			"-f", "mp4",
+			"-movflags", "+faststart",
+			output,
+		)
+		return "audio/mp4", err
+	default:
+		return "", fmt.Errorf("unsupported AUDIO_FORMAT: %s", cfg.AudioFormat)
+	}
+}
+
+// extractPeaks decodes the audio file to mono 16-bit PCM and reduces it to the
+// given number of normalized peak values, also returning the duration.
+func extractPeaks(source string, buckets int) ([]float64, float64, error) {
+	pcm, err := execFFmpeg(
+		"-i", source,
+		"-vn",
+		"-ac", "1",
+		"-ar", fmt.Sprint(peaksSampleRate),
+		"-f", "s16le",
+		"pipe:1",
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to decode audio: %w", err)
+	}
+
+	samples := len(pcm) / 2
+	duration := float64(samples) / peaksSampleRate
+	peaks := make([]float64, buckets)
+	if samples == 0 {
+		return peaks, 0, nil
+	}
+
+	perBucket := int(math.Ceil(float64(samples) / float64(buckets)))
+	for i := 0; i < samples; i++ {
+		sample := int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+		amplitude := math.Abs(float64(sample)) / math.MaxInt16
+		bucket := i / perBucket
+		if amplitude > peaks[bucket] {
+			peaks[bucket] = math.Min(amplitude, 1)
+		}
+	}
+
+	return peaks, duration, nil
+}
@@ -27,6 +27,7 @@ export class FileViewComponent implements OnInit, OnDestroy {
   requiresPassword = false;
   password = '';
   invalidPassword = false;
+  accessToken: string | null = null;
   fileIsPending = false;
   private routeSubscription: Subscription | undefined;
   private fileSubscription: Subscription | undefined;
@@ -63,7 +64,7 @@ export class FileViewComponent implements OnInit, OnDestroy {
       },
       error: (err) => {
         this.errorFetchingFile =
-          err.error?.error || 'Error fetching file details.';
+          err.error?.error?.message || 'Error fetching file details.';
         this.isLoading = false;
       },
     });
@@ -83,11 +84,10 @@ export class FileViewComponent implements OnInit, OnDestroy {
   }
 
   downloadFile(): void {
-    if (this.fileData && this.customUrl && this.fileContentUrl) {
-      this.fileService.addDownload(this.customUrl).subscribe();
+    if (this.fileData && this.customUrl) {
+      // The server counts the download and names the file
       const a = document.createElement('a');
-      a.href = this.fileContentUrl.toString();
-      a.download = this.fileData.originalName;
+      a.href = this.fileService.downloadUrl(this.customUrl, this.accessToken);
       document.body.appendChild(a);
       a.click();
       document.body.removeChild(a);
@@ -104,6 +104,7 @@ export class FileViewComponent implements OnInit, OnDestroy {
             this.isLoading = false;
           } else if (response.path) {
             this.requiresPassword = false;
+            this.accessToken = response.accessToken ?? null;
             this.fileContentUrl = this.sanitizer.bypassSecurityTrustResourceUrl(
               response.path
             );
@@ -118,7 +119,7 @@ export class FileViewComponent implements OnInit, OnDestroy {
           } else if (err.status === 425) {
             this.fileIsPending = true;
           } else {
-            this.errorFetchingFile = err.error?.error || 'Error fetching file.';
+            this.errorFetchingFile = err.error?.error?.message || 'Error fetching file.';
           }
           this.isLoading = false;
         },
@@ -149,7 +150,7 @@ export class FileViewComponent implements OnInit, OnDestroy {
           } else if (err.status === 425) {
             this.fileIsPending = true;
           } else {
-            this.errorFetchingFile = err.error?.error || 'Error fetching file.';
+            this.errorFetchingFile = err.error?.error?.message || 'Error fetching file.';
           }
           this.isLoading = false;
         },
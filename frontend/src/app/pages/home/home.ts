@@ -45,7 +45,7 @@ export class Home {
           if (configResult) {
             // Update file settings
             this.fileService
-              .setFileSettings(result.customUrl, configResult)
+              .setFileSettings(result.customUrl, configResult, result.managementToken)
               .subscribe(
                 (response: any) => {
                     window.location.href = `/${result.customUrl}`;
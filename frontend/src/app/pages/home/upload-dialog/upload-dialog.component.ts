@@ -141,7 +141,10 @@ export class UploadDialogComponent implements OnInit {
       clearInterval(progressInterval);
       this.uploadProgress = 100;
       this.showSuccess('File uploaded successfully!');
-      this.dialogRef.close({ customUrl: response.customUrl });
+      this.dialogRef.close({
+        customUrl: response.customUrl,
+        managementToken: response.managementToken,
+      });
     } catch (error) {
       console.error('Upload failed:', error);
       this.errorMessage = 'Upload failed. Please try again.';
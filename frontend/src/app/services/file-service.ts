@@ -10,6 +10,7 @@ interface UploadResponse {
   status: string;
   customUrl: string;
   statusUrl: string;
+  managementToken: string;
 }
 
 @Injectable({
@@ -29,18 +30,23 @@ export class FileService {
     });
   }
 
-  setFileSettings(customUrl: string, settings: FileSettings): Observable<any> {
+  setFileSettings(
+    customUrl: string,
+    settings: FileSettings,
+    managementToken: string
+  ): Observable<any> {
     return this.http.put(
       this.API_URL + '/' + customUrl + '/settings',
-      settings
+      settings,
+      { headers: { 'X-Management-Token': managementToken } }
     );
   }
 
   getFileWithPassword(
     customUrl: string,
     password: string
-  ): Observable<{ path: string; requiresPassword?: boolean }> {
-    return this.http.post<{ path: string; requiresPassword?: boolean }>(
+  ): Observable<{ path: string; requiresPassword?: boolean; accessToken?: string }> {
+    return this.http.post<{ path: string; requiresPassword?: boolean; accessToken?: string }>(
       this.API_URL + '/' + customUrl,
       { password }
     );
@@ -62,7 +68,10 @@ export class FileService {
     return this.http.get<FileType>(`${this.API_URL}/${customUrl}/info`);
   }
 
-  addDownload(customUrl: string): Observable<any> {
-    return this.http.put(`${this.API_URL}/${customUrl}/addDownload`, {});
+  // Downloads are plain links, so the access token of a password protected
+  // file travels in the query
+  downloadUrl(customUrl: string, accessToken?: string | null): string {
+    const url = `${this.API_URL}/${customUrl}/download`;
+    return accessToken ? `${url}?access_token=${encodeURIComponent(accessToken)}` : url;
   }
 }
@@ -1,7 +1,6 @@
 export type File = {
   id: number;
   customUrl: string;
-  path?: string;
   originalName: string;
   size: number;
   type: string;